@@ -0,0 +1,129 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ERRORS
+var (
+	ErrInvalidConfig error = errors.New("invalid config")
+)
+
+// Config of the server, read from a JSON file
+type Config struct {
+	// Address to listen on
+	Port string `json:"port"`
+	// Storage backend, bolt or sqlite
+	Store   string  `json:"store"`
+	DB      string  `json:"db"`
+	Economy Economy `json:"economy"`
+}
+
+// Prices, payouts and funding rules of the game, all in sat
+type Economy struct {
+	GameStartCost int `json:"gameStartCost"`
+	// Stake of a round when the player does not pick one
+	FirstRollCost int `json:"firstRollCost"`
+	// Payout of rounds started before players picked stakes
+	WinningAmount int `json:"winningAmount"`
+	// Limits of the stake a player can pick, both inclusive
+	MinStake int `json:"minStake"`
+	MaxStake int `json:"maxStake"`
+	// Share of the fair payout the house keeps, 0.05 is 5%
+	HouseEdge float64 `json:"houseEdge"`
+	// Amount added by one wallet funding
+	FundWalletAmount int `json:"fundWalletAmount"`
+	// Wallets holding more than this cannot be funded
+	FundWalletThreshold int `json:"fundWalletThreshold"`
+}
+
+// Default returns the config the server ran with before it could be configured
+func Default() Config {
+	return Config{
+		Port:    ":9000",
+		Store:   "bolt",
+		DB:      "my.db",
+		Economy: DefaultEconomy(),
+	}
+}
+
+func DefaultEconomy() Economy {
+	return Economy{
+		GameStartCost:       20,
+		FirstRollCost:       5,
+		WinningAmount:       20,
+		MinStake:            1,
+		MaxStake:            500,
+		HouseEdge:           0.05,
+		FundWalletAmount:    155,
+		FundWalletThreshold: 35,
+	}
+}
+
+// Load reads the config file at path on top of the defaults and validates it, unknown fields are rejected so typos do not go unnoticed
+func Load(path string) (Config, error) {
+	config := Default()
+	file, err := os.Open(path)
+	if err != nil {
+		return config, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("%w %s - %s", ErrInvalidConfig, path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("%s - %w", path, err)
+	}
+	return config, nil
+}
+
+// Validate reports the first setting that cannot work
+func (c Config) Validate() error {
+	if c.Port == "" {
+		return fmt.Errorf("%w, port is required", ErrInvalidConfig)
+	}
+	if c.Store != "bolt" && c.Store != "sqlite" {
+		return fmt.Errorf("%w, store must be bolt or sqlite", ErrInvalidConfig)
+	}
+	if c.DB == "" {
+		return fmt.Errorf("%w, db is required", ErrInvalidConfig)
+	}
+	return c.Economy.Validate()
+}
+
+func (e Economy) Validate() error {
+	settings := []struct {
+		name  string
+		value int
+	}{
+		{"gameStartCost", e.GameStartCost},
+		{"firstRollCost", e.FirstRollCost},
+		{"winningAmount", e.WinningAmount},
+		{"fundWalletAmount", e.FundWalletAmount},
+		{"minStake", e.MinStake},
+	}
+	for _, setting := range settings {
+		if setting.value < 1 {
+			return fmt.Errorf("%w, economy.%s must be a positive number", ErrInvalidConfig, setting.name)
+		}
+	}
+	if e.MaxStake < e.MinStake {
+		return fmt.Errorf("%w, economy.maxStake cannot be below minStake", ErrInvalidConfig)
+	}
+	if e.FirstRollCost < e.MinStake || e.FirstRollCost > e.MaxStake {
+		return fmt.Errorf("%w, economy.firstRollCost must be between minStake and maxStake", ErrInvalidConfig)
+	}
+	if e.HouseEdge < 0 || e.HouseEdge >= 1 {
+		return fmt.Errorf("%w, economy.houseEdge must be at least 0 and below 1", ErrInvalidConfig)
+	}
+	if e.FundWalletThreshold < 0 {
+		return fmt.Errorf("%w, economy.fundWalletThreshold cannot be negative", ErrInvalidConfig)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package dice
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Dice ranges
+const (
+	DieMin    int = 1
+	DieMax    int = 6
+	TargetMin int = 2
+	TargetMax int = 12
+)
+
+// ERRORS
+var (
+	ErrInvalidRange error = errors.New("invalid roll range")
+)
+
+// Roller returns uniformly distributed numbers between min and max, both inclusive
+type Roller interface {
+	Roll(min, max int) (int, error)
+}
+
+// Roll a single six sided die
+func Die(r Roller) (int, error) {
+	return r.Roll(DieMin, DieMax)
+}
+
+// Roll the winning target a pair of dice has to add up to
+func Target(r Roller) (int, error) {
+	return r.Roll(TargetMin, TargetMax)
+}
+
+// readerRoller draws numbers from a byte stream using rejection sampling so every value is equally likely
+type readerRoller struct {
+	mu     sync.Mutex
+	source io.Reader
+	buf    [8]byte
+}
+
+// Create a roller drawing from source, rolls are deterministic if source is
+func NewRoller(source io.Reader) Roller {
+	return &readerRoller{source: source}
+}
+
+// Create a roller backed by crypto/rand, this is the one used in production
+func NewCryptoRoller() Roller {
+	return NewRoller(rand.Reader)
+}
+
+func (r *readerRoller) Roll(min, max int) (int, error) {
+	if max < min {
+		return 0, ErrInvalidRange
+	}
+	n := uint64(max-min) + 1
+	// Largest multiple of n that fits in a uint64, values at or above it would favour the low results
+	limit := ^uint64(0) - (^uint64(0) % n)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for {
+		if _, err := io.ReadFull(r.source, r.buf[:]); err != nil {
+			return 0, fmt.Errorf("unable to read random bytes - %w", err)
+		}
+		v := binary.BigEndian.Uint64(r.buf[:])
+		if v < limit {
+			return min + int(v%n), nil
+		}
+	}
+}
+
+// sequenceRoller replays fixed values, it lets tests decide exactly what is rolled
+type sequenceRoller struct {
+	mu     sync.Mutex
+	values []int
+	next   int
+}
+
+// Create a roller returning values in order, starting over once they run out
+func NewSequenceRoller(values ...int) Roller {
+	return &sequenceRoller{values: values}
+}
+
+func (s *sequenceRoller) Roll(min, max int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.values) == 0 {
+		return 0, errors.New("sequence roller has no values")
+	}
+	v := s.values[s.next%len(s.values)]
+	s.next++
+	if v < min || v > max {
+		return 0, fmt.Errorf("sequence value %d outside %d-%d", v, min, max)
+	}
+	return v, nil
+}
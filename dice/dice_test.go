@@ -0,0 +1,180 @@
+package dice
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"math/rand"
+	"testing"
+)
+
+// The chi-square tests draw from a seeded source so they give the same answer on every run,
+// go test ./dice -chisquare.crypto runs them against crypto/rand as well
+var chiSquareCrypto = flag.Bool("chisquare.crypto", false, "also run the chi-square tests against crypto/rand, a fair roller fails one run in a thousand")
+
+// Draws per face in the chi-square tests
+const drawsPerFace = 10000
+
+// Chi-square critical values at p = 0.001 for 5 and 10 degrees of freedom
+const (
+	chiSquareDie    float64 = 20.515
+	chiSquareTarget float64 = 29.588
+)
+
+// Every value below the limit maps to a face, and each face gets the same share of them.
+// Runs of consecutive values from both ends of the accepted range are spread evenly over the faces
+func TestRollerMapsValuesEvenly(t *testing.T) {
+	tests := []struct {
+		name     string
+		roll     func(Roller) (int, error)
+		min, max int
+	}{
+		{"die", Die, DieMin, DieMax},
+		{"target", Target, TargetMin, TargetMax},
+	}
+	const runs = 3
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := tt.max - tt.min + 1
+			top := limit(n)
+			values := make([]uint64, 0, 2*runs*n)
+			for i := 0; i < runs*n; i++ {
+				values = append(values, uint64(i), top-1-uint64(i))
+			}
+			r := NewRoller(stream(values...))
+			counts := make([]int, n)
+			for range values {
+				v, err := tt.roll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if v < tt.min || v > tt.max {
+					t.Fatalf("rolled %d outside %d-%d", v, tt.min, tt.max)
+				}
+				counts[v-tt.min]++
+			}
+			for i, count := range counts {
+				if count != 2*runs {
+					t.Errorf("%d rolled %d times, want %d - counts %v", tt.min+i, count, 2*runs, counts)
+				}
+			}
+		})
+	}
+}
+
+func TestDieIsUniform(t *testing.T) {
+	for name, r := range chiSquareRollers(t) {
+		t.Run(name, func(t *testing.T) {
+			counts := draw(t, r, Die, DieMin, DieMax)
+			if chi := chiSquare(counts); chi > chiSquareDie {
+				t.Errorf("chi-square %.2f above %.2f, counts %v", chi, chiSquareDie, counts)
+			}
+		})
+	}
+}
+
+func TestTargetIsUniform(t *testing.T) {
+	for name, r := range chiSquareRollers(t) {
+		t.Run(name, func(t *testing.T) {
+			counts := draw(t, r, Target, TargetMin, TargetMax)
+			if chi := chiSquare(counts); chi > chiSquareTarget {
+				t.Errorf("chi-square %.2f above %.2f, counts %v", chi, chiSquareTarget, counts)
+			}
+		})
+	}
+}
+
+// Rollers the chi-square tests draw from, the crypto roller only with -chisquare.crypto
+func chiSquareRollers(t *testing.T) map[string]Roller {
+	rollers := map[string]Roller{"seeded": NewRoller(rand.New(rand.NewSource(1)))}
+	if *chiSquareCrypto {
+		rollers["crypto"] = NewCryptoRoller()
+	} else {
+		t.Log("crypto/rand is not checked, run with -chisquare.crypto")
+	}
+	return rollers
+}
+
+// Values at or above the limit would favour the low results, they are dropped and the next value is read
+func TestRollerRejectsValuesAboveLimit(t *testing.T) {
+	dieLimit := limit(DieMax - DieMin + 1)
+	targetLimit := limit(TargetMax - TargetMin + 1)
+	tests := []struct {
+		name   string
+		roll   func(Roller) (int, error)
+		values []uint64
+		want   int
+	}{
+		{"die skips the largest value", Die, []uint64{^uint64(0), 0}, 1},
+		{"die skips the limit", Die, []uint64{dieLimit, 1}, 2},
+		{"die rolls 6 just under the limit", Die, []uint64{dieLimit - 1}, 6},
+		{"die rolls 6", Die, []uint64{5}, 6},
+		{"target skips every rejected value", Target, []uint64{^uint64(0), targetLimit, targetLimit + 1, 3}, 5},
+		{"target rolls 12 just under the limit", Target, []uint64{targetLimit - 1}, 12},
+		{"target rolls 12", Target, []uint64{10}, 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.roll(NewRoller(stream(tt.values...)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("rolled %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// A source holding only rejected values runs dry instead of returning one of them
+func TestRollerNeverReturnsRejectedValues(t *testing.T) {
+	r := NewRoller(stream(limit(DieMax-DieMin+1), ^uint64(0)))
+	if v, err := Die(r); err == nil {
+		t.Errorf("rolled %d from rejected values", v)
+	}
+}
+
+// Roll fn drawsPerFace times per face with r and count each result, every face from min to max has to come up
+func draw(t *testing.T, r Roller, fn func(Roller) (int, error), min, max int) []int {
+	t.Helper()
+	counts := make([]int, max-min+1)
+	for i := 0; i < drawsPerFace*len(counts); i++ {
+		v, err := fn(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v < min || v > max {
+			t.Fatalf("rolled %d outside %d-%d", v, min, max)
+		}
+		counts[v-min]++
+	}
+	for i, count := range counts {
+		if count == 0 {
+			t.Errorf("%d was never rolled", min+i)
+		}
+	}
+	return counts
+}
+
+func chiSquare(counts []int) float64 {
+	var chi float64
+	for _, count := range counts {
+		d := float64(count - drawsPerFace)
+		chi += d * d / drawsPerFace
+	}
+	return chi
+}
+
+// First value the roller rejects for a range of n results
+func limit(n int) uint64 {
+	return ^uint64(0) - (^uint64(0) % uint64(n))
+}
+
+// Byte stream of values as the roller reads them
+func stream(values ...uint64) *bytes.Reader {
+	buf := make([]byte, 8*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint64(buf[8*i:], v)
+	}
+	return bytes.NewReader(buf)
+}
@@ -0,0 +1,88 @@
+package dice
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// SeedSize is the number of random bytes in a server seed
+const SeedSize int = 32
+
+// FairRoll is the outcome of one provably fair roll
+type FairRoll struct {
+	WinningGame int `json:"winningGame"`
+	FirstRoll   int `json:"firstRoll"`
+	SecondRoll  int `json:"secondRoll"`
+}
+
+// Generate a hex encoded seed of size random bytes drawn from r
+func NewSeed(r Roller, size int) (string, error) {
+	seed := make([]byte, size)
+	for i := range seed {
+		b, err := r.Roll(0, 255)
+		if err != nil {
+			return "", err
+		}
+		seed[i] = byte(b)
+	}
+	return hex.EncodeToString(seed), nil
+}
+
+// Hex encoded sha256 of the server seed, published as the commitment when a game starts
+func HashSeed(serverSeed string) string {
+	sum := sha256.Sum256([]byte(serverSeed))
+	return hex.EncodeToString(sum[:])
+}
+
+// Fair derives the winning target, first and second dice of roll number nonce.
+// The bytes are HMAC-SHA256(serverSeed, "clientSeed:nonce:counter") for counter 0, 1, ...
+// read through the same rejection sampling as every other roller, in the order target, first, second
+func Fair(serverSeed, clientSeed string, nonce int) (*FairRoll, error) {
+	r := FairRoller(serverSeed, clientSeed, nonce)
+
+	var (
+		roll FairRoll
+		err  error
+	)
+	if roll.WinningGame, err = Target(r); err != nil {
+		return nil, err
+	}
+	if roll.FirstRoll, err = Die(r); err != nil {
+		return nil, err
+	}
+	if roll.SecondRoll, err = Die(r); err != nil {
+		return nil, err
+	}
+	return &roll, nil
+}
+
+// FairRoller draws from the HMAC stream of roll number nonce, every roller for the same seeds and nonce returns the same values
+func FairRoller(serverSeed, clientSeed string, nonce int) Roller {
+	return NewRoller(&hmacStream{key: []byte(serverSeed), message: fmt.Sprintf("%s:%d", clientSeed, nonce)})
+}
+
+// hmacStream is an endless reader of HMAC blocks keyed by the server seed
+type hmacStream struct {
+	key     []byte
+	message string
+	counter int
+	block   []byte
+}
+
+func (h *hmacStream) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(h.block) == 0 {
+			mac := hmac.New(sha256.New, h.key)
+			_, _ = fmt.Fprintf(mac, "%s:%d", h.message, h.counter)
+			h.block = mac.Sum(nil)
+			h.counter++
+		}
+		c := copy(p[n:], h.block)
+		h.block = h.block[c:]
+		n += c
+	}
+	return n, nil
+}
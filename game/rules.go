@@ -0,0 +1,82 @@
+package game
+
+import (
+	"errors"
+	"math"
+
+	"github.com/promisefemi/apexnetwork-take-home/config"
+	"github.com/promisefemi/apexnetwork-take-home/dice"
+	"github.com/promisefemi/apexnetwork-take-home/model"
+)
+
+// ERRORS
+var (
+	ErrUnknownRules error = errors.New("unknown game rules")
+)
+
+// Rules decide how a round of a dice game plays out, the handlers take the stake, store the round and pay out.
+// A round is one RollSession, it starts with the first roll and takes further rolls until it has an outcome.
+// Every die thrown is added to the Throws of the round, fields only the rule set understands stay out of the handlers.
+// The roller given to StartRound and ApplyRoll starts at the beginning of the dice of the round every time,
+// so a rule set that needs more dice on a later roll draws the earlier ones again and uses the next
+type Rules interface {
+	// Name is stored on the game session, so every round of a game is played by the same rules
+	Name() string
+	// StartRound opens round with its first roll. The first roll can lose a round the next roll could not win,
+	// it cannot win one, the stake is only taken by the next roll
+	StartRound(round *model.RollSession, r dice.Roller) error
+	// ApplyRoll adds the next roll to a round that is still pending
+	ApplyRoll(round *model.RollSession, r dice.Roller) error
+	// Outcome of the round so far
+	Outcome(round model.RollSession) Outcome
+	// Probability that the next roll wins a pending round
+	Probability(round model.RollSession) float64
+	// Payout if the round is won, quoted from its stake after the first roll. The stake is taken by the roll
+	// that follows the quote, so the quote is priced on the Probability of that roll
+	Payout(round model.RollSession, economy config.Economy) int
+	// Result shows the dice of the round to the player, the handler adds the ids, the payout, the balances and the odds
+	Result(round model.RollSession) model.RollResult
+	// Message shown to the player after a roll, payout is 0 unless the round was won
+	Message(round model.RollSession, payout int) string
+}
+
+type Outcome int
+
+const (
+	// More rolls are needed
+	Pending Outcome = iota
+	Won
+	Lost
+)
+
+// Rule set of games that do not name one, they were all played by the target game
+const DefaultRules string = TargetName
+
+var registry = map[string]Rules{
+	TargetName: Target{},
+}
+
+// Lookup returns the rule set stored on a game session
+func Lookup(name string) (Rules, error) {
+	if name == "" {
+		name = DefaultRules
+	}
+	rules, ok := registry[name]
+	if !ok {
+		return nil, ErrUnknownRules
+	}
+	return rules, nil
+}
+
+// Odds of a pending round, the multiplier is the inverse of the probability less the house edge, rounded to 4 decimals
+// so the payout is exactly the stake times the multiplier shown, rounded down to whole sat. A round that can no longer be won pays nothing
+func Odds(rules Rules, round model.RollSession, economy config.Economy) model.RollOdds {
+	odds := model.RollOdds{Stake: round.Stake, Probability: rules.Probability(round)}
+	if odds.Probability <= 0 {
+		return odds
+	}
+	basisPoints := math.Round((1 - economy.HouseEdge) / odds.Probability * 10000)
+	odds.Multiplier = basisPoints / 10000
+	odds.PotentialPayout = round.Stake * int(basisPoints) / 10000
+	return odds
+}
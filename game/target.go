@@ -0,0 +1,109 @@
+package game
+
+import (
+	"fmt"
+
+	"github.com/promisefemi/apexnetwork-take-home/config"
+	"github.com/promisefemi/apexnetwork-take-home/dice"
+	"github.com/promisefemi/apexnetwork-take-home/model"
+)
+
+const TargetName string = "target"
+
+// Target is the original game, a target between 2 and 12 is drawn with the first die
+// and the round is won when the second die brings the total to exactly the target
+type Target struct{}
+
+func (Target) Name() string {
+	return TargetName
+}
+
+// Dice of a round are drawn in the order target, first die, second die
+func (Target) StartRound(round *model.RollSession, r dice.Roller) error {
+	var err error
+	if round.WinningGame, err = dice.Target(r); err != nil {
+		return err
+	}
+	if round.FirstRoll, err = dice.Die(r); err != nil {
+		return err
+	}
+	round.Throws = []int{round.FirstRoll}
+	return nil
+}
+
+func (Target) ApplyRoll(round *model.RollSession, r dice.Roller) error {
+	//Draw the target and first die again, they were used when the round started
+	if _, err := dice.Target(r); err != nil {
+		return err
+	}
+	if _, err := dice.Die(r); err != nil {
+		return err
+	}
+	var err error
+	if round.SecondRoll, err = dice.Die(r); err != nil {
+		return err
+	}
+	//Rounds started before throws were recorded only have the first die in its own field
+	if len(round.Throws) == 0 {
+		round.Throws = []int{round.FirstRoll}
+	}
+	round.Throws = append(round.Throws, round.SecondRoll)
+	return nil
+}
+
+func (t Target) Outcome(round model.RollSession) Outcome {
+	if round.SecondRoll == 0 {
+		//A target the second die cannot reach loses the round on the first roll
+		if t.Probability(round) == 0 {
+			return Lost
+		}
+		return Pending
+	}
+	if round.FirstRoll+round.SecondRoll == round.WinningGame {
+		return Won
+	}
+	return Lost
+}
+
+// The second die has to show exactly what is missing to the target, targets out of reach cannot be won
+func (Target) Probability(round model.RollSession) float64 {
+	need := round.WinningGame - round.FirstRoll
+	if need < dice.DieMin || need > dice.DieMax {
+		return 0
+	}
+	return 1 / float64(dice.DieMax-dice.DieMin+1)
+}
+
+func (t Target) Payout(round model.RollSession, economy config.Economy) int {
+	return Odds(t, round, economy).PotentialPayout
+}
+
+// The target game reports its dice as the first and second roll next to the target and what is needed to reach it
+func (Target) Result(round model.RollSession) model.RollResult {
+	result := model.RollResult{
+		Phase:      model.FIRST_ROLL,
+		FirstRoll:  round.FirstRoll,
+		SecondRoll: round.SecondRoll,
+		Target:     round.WinningGame,
+		Needed:     round.WinningGame - round.FirstRoll,
+		Throws:     round.Throws,
+	}
+	if round.SecondRoll != 0 {
+		result.Phase = model.SECOND_ROLL
+	}
+	return result
+}
+
+func (t Target) Message(round model.RollSession, payout int) string {
+	switch t.Outcome(round) {
+	case Pending:
+		//Return the number rolled and how many they have to roll to win
+		return fmt.Sprintf("Congrats, you rolled %d to win you have to to roll %d 🤞", round.FirstRoll, round.WinningGame-round.FirstRoll)
+	case Won:
+		return fmt.Sprintf("Hurray 🤑, you have won %d, do you want to try again ", payout)
+	}
+	if round.SecondRoll == 0 {
+		return fmt.Sprintf("Oops 😥, you rolled %d and %d cannot be reached with one dice, your stake was not taken, roll again ", round.FirstRoll, round.WinningGame)
+	}
+	return fmt.Sprintf("Oops 😥, you did not win you rolled %d, but you can try again ", round.SecondRoll)
+}
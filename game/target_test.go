@@ -0,0 +1,91 @@
+package game
+
+import (
+	"math"
+	"testing"
+
+	"github.com/promisefemi/apexnetwork-take-home/config"
+	"github.com/promisefemi/apexnetwork-take-home/dice"
+	"github.com/promisefemi/apexnetwork-take-home/model"
+)
+
+// A first die that leaves the target out of reach of the second die loses the round at once
+func TestTargetOutcome(t *testing.T) {
+	tests := []struct {
+		name  string
+		round model.RollSession
+		want  Outcome
+	}{
+		{"target reachable", model.RollSession{WinningGame: 8, FirstRoll: 2}, Pending},
+		{"target of the first die", model.RollSession{WinningGame: 6, FirstRoll: 6}, Lost},
+		{"target below the first die", model.RollSession{WinningGame: 2, FirstRoll: 5}, Lost},
+		{"target above one die", model.RollSession{WinningGame: 12, FirstRoll: 1}, Lost},
+		{"second die hits", model.RollSession{WinningGame: 8, FirstRoll: 2, SecondRoll: 6}, Won},
+		{"second die misses", model.RollSession{WinningGame: 8, FirstRoll: 2, SecondRoll: 5}, Lost},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Target{}).Outcome(tt.round); got != tt.want {
+				t.Errorf("outcome %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// Over every round the dice can make the player gets back the stake less the house edge. The stake is only taken
+// from rounds the first die left open, so those are the rounds the payout is measured against
+func TestTargetPaysStakeLessHouseEdge(t *testing.T) {
+	economy := config.Economy{HouseEdge: 0.05}
+	rules := Target{}
+	const stake = 1000
+
+	var staked, paid int
+	for target := dice.TargetMin; target <= dice.TargetMax; target++ {
+		for first := dice.DieMin; first <= dice.DieMax; first++ {
+			round := model.RollSession{Stake: stake, WinningGame: target, FirstRoll: first}
+			if rules.Outcome(round) != Pending {
+				continue
+			}
+			payout := rules.Payout(round, economy)
+			for second := dice.DieMin; second <= dice.DieMax; second++ {
+				round.SecondRoll = second
+				staked += stake
+				if rules.Outcome(round) == Won {
+					paid += payout
+				}
+			}
+		}
+	}
+	returned := float64(paid) / float64(staked)
+	if math.Abs(returned-(1-economy.HouseEdge)) > 0.001 {
+		t.Errorf("rounds return %.4f of the stake, want %.4f", returned, 1-economy.HouseEdge)
+	}
+}
+
+// The multiplier shown is the inverse of the probability shown less the house edge, and the payout the stake times it
+func TestTargetOdds(t *testing.T) {
+	economy := config.Economy{HouseEdge: 0.05}
+	tests := []struct {
+		name        string
+		round       model.RollSession
+		probability float64
+		multiplier  float64
+		payout      int
+	}{
+		{"needs a 1", model.RollSession{Stake: 10, WinningGame: 2, FirstRoll: 1}, 1.0 / 6, 5.7, 57},
+		{"needs a 6", model.RollSession{Stake: 10, WinningGame: 8, FirstRoll: 2}, 1.0 / 6, 5.7, 57},
+		{"rounds down to whole sat", model.RollSession{Stake: 7, WinningGame: 8, FirstRoll: 2}, 1.0 / 6, 5.7, 39},
+		{"target out of reach", model.RollSession{Stake: 10, WinningGame: 12, FirstRoll: 1}, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			odds := Odds(Target{}, tt.round, economy)
+			if odds.Probability != tt.probability || odds.Multiplier != tt.multiplier || odds.PotentialPayout != tt.payout {
+				t.Errorf("odds %+v, want probability %v, multiplier %v and payout %d", odds, tt.probability, tt.multiplier, tt.payout)
+			}
+			if odds.Probability > 0 && math.Abs(odds.Multiplier-(1-economy.HouseEdge)/odds.Probability) > 0.0001 {
+				t.Errorf("multiplier %v does not match probability %v", odds.Multiplier, odds.Probability)
+			}
+		})
+	}
+}
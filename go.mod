@@ -3,7 +3,11 @@ module github.com/promisefemi/apexnetwork-take-home
 go 1.19
 
 require (
-	github.com/boltdb/bolt v1.3.1 // indirect
-	github.com/go-chi/chi v1.5.4 // indirect
-	golang.org/x/sys v0.8.0 // indirect
+	github.com/boltdb/bolt v1.3.1
+	github.com/go-chi/chi v1.5.4
+	github.com/mattn/go-sqlite3 v1.14.33
+	github.com/oklog/ulid/v2 v2.1.1
+	golang.org/x/crypto v0.14.0
 )
+
+require golang.org/x/sys v0.13.0 // indirect
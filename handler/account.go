@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/store"
+	"github.com/promisefemi/apexnetwork-take-home/util"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Account settings
+const (
+	SessionPrefix     string        = "aps_"
+	SessionTTL        time.Duration = 7 * 24 * time.Hour
+	minPasswordLength int           = 8
+	// bcrypt ignores everything past 72 bytes
+	maxPasswordLength int = 72
+)
+
+// ERRORS
+var (
+	ErrCredentialsRequired error = errors.New("Please enter both username and password")
+	ErrInvalidUsername     error = errors.New("username must be 3 to 32 letters, digits, dots, dashes or underscores")
+	ErrInvalidPassword     error = errors.New("password must be between 8 and 72 characters")
+	ErrUsernameTaken       error = errors.New("username is already taken")
+	ErrInvalidLogin        error = errors.New("incorrect username or password")
+	ErrNotLoginSession     error = errors.New("logout ends login sessions, this request was made with an API key")
+	ErrUnableToLogin       error = errors.New("unable to log in, please contact support")
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_.-]{3,32}$`)
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// Usernames are case insensitive
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// Validate username and password and hash the password, done before any write transaction since bcrypt is slow on purpose
+func newCredential(userID, username, password string) (*model.Credential, error) {
+	if username == "" || password == "" {
+		return nil, ErrCredentialsRequired
+	}
+	if !usernamePattern.MatchString(username) {
+		return nil, ErrInvalidUsername
+	}
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return nil, ErrInvalidPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	return &model.Credential{
+		Username:     username,
+		UserID:       userID,
+		PasswordHash: string(hash),
+		CreatedAt:    time.Now().Unix(),
+	}, nil
+}
+
+// Log in with username and password, starts a new session whose token authenticates like an API key until it expires or is logged out
+func (p *PageHandler) Login(rw http.ResponseWriter, r *http.Request) {
+	input, err := readParams(r)
+	if err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+
+	username := normalizeUsername(input.get("username"))
+	password := input.get("password")
+	if username == "" || password == "" {
+		p.fail(rw, ErrCredentialsRequired, nil)
+		return
+	}
+
+	var credential *model.Credential
+	err = p.store.View(func(tx store.Tx) error {
+		var err error
+		credential, err = tx.GetCredential(username)
+		return err
+	})
+	if err != nil {
+		if err != store.ErrNotFound {
+			log.Printf("error getting credential - %s", err)
+		}
+		//Spend the same time on unknown usernames, so they cannot be told apart from a wrong password
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+		})
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		p.fail(rw, ErrInvalidLogin, nil)
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(credential.PasswordHash), []byte(password)) != nil {
+		p.fail(rw, ErrInvalidLogin, nil)
+		return
+	}
+
+	token, err := util.GenerateToken(SessionPrefix)
+	if err != nil {
+		log.Printf("error generating session token - %s", err)
+		p.fail(rw, ErrUnableToLogin, nil)
+		return
+	}
+	now := time.Now()
+	session := &model.AuthSession{
+		TokenHash: util.HashToken(token),
+		UserID:    credential.UserID,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(SessionTTL).Unix(),
+	}
+
+	var user *model.User
+	err = p.store.Update(func(tx store.Tx) error {
+		var err error
+		user, err = getUser(tx, credential.UserID)
+		if err != nil {
+			return err
+		}
+		return tx.PutAuthSession(session)
+	})
+	if err != nil {
+		log.Printf("error starting session - %s", err)
+		p.fail(rw, ErrUnableToLogin, nil)
+		return
+	}
+
+	p.success(rw, "Login successful", model.Login{
+		Token:     token,
+		ExpiresAt: session.ExpiresAt,
+		Username:  credential.Username,
+		User:      *user,
+	})
+	return
+}
+
+// Revoke the session the request was made with
+func (p *PageHandler) Logout(rw http.ResponseWriter, r *http.Request) {
+	tokenHash := sessionHash(r)
+	if tokenHash == "" {
+		p.fail(rw, ErrNotLoginSession, nil)
+		return
+	}
+
+	err := p.store.Update(func(tx store.Tx) error {
+		session, err := tx.GetAuthSession(tokenHash)
+		if err != nil {
+			return err
+		}
+		session.RevokedAt = time.Now().Unix()
+		return tx.PutAuthSession(session)
+	})
+	if err != nil {
+		log.Printf("error revoking session - %s", err)
+		p.fail(rw, ErrUnauthorized, nil)
+		return
+	}
+
+	p.success(rw, "Logged out", nil)
+	return
+}
+
+// Remove login sessions that have expired
+func (p *PageHandler) PruneAuthSessions() (int, error) {
+	var removed int
+	err := p.store.Update(func(tx store.Tx) error {
+		var err error
+		removed, err = tx.DeleteAuthSessions(time.Now().Unix())
+		return err
+	})
+	return removed, err
+}
@@ -0,0 +1,410 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/store"
+	"github.com/promisefemi/apexnetwork-take-home/util"
+)
+
+// Admin settings
+const (
+	CLIActor         string = "cli"
+	defaultUserLimit int    = 50
+	maxUserLimit     int    = 500
+)
+
+// ERRORS
+var (
+	ErrForbidden         error = errors.New("this action needs the admin role")
+	ErrReasonRequired    error = errors.New("Please give a reason for this action")
+	ErrInvalidRole       error = errors.New("role must be PLAYER or ADMIN")
+	ErrInvalidLimit      error = errors.New("limit must be a positive number")
+	ErrAdminAction       error = errors.New("unable to complete admin action, please contact support")
+	ErrInvalidAmount     error = errors.New("amount must be a positive whole number")
+	ErrAssetNotGrantable error = errors.New("only bonus and points can be granted, sat comes in through wallet funding")
+)
+
+// RequireAdmin lets only authenticated users with the admin role through, it must run after Authenticate
+func (p *PageHandler) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var user *model.User
+		err := p.store.View(func(tx store.Tx) error {
+			var err error
+			user, err = getUser(tx, UserID(r))
+			return err
+		})
+		if err != nil {
+			p.fail(rw, ErrUnauthorized, nil)
+			return
+		}
+		if !user.IsAdmin() || user.Frozen {
+			p.fail(rw, ErrForbidden, nil)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// List users, q matches user ID, username, first or last name
+func (p *PageHandler) AdminListUsers(rw http.ResponseWriter, r *http.Request) {
+	query := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	limit := defaultUserLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			p.fail(rw, ErrInvalidLimit, nil)
+			return
+		}
+		if limit > maxUserLimit {
+			limit = maxUserLimit
+		}
+	}
+	if err := p.auditRead(r, model.VIEW_USERS, ""); err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+
+	users := make([]model.User, 0)
+	err := p.store.View(func(tx store.Tx) error {
+		all, err := tx.ListUsers()
+		if err != nil {
+			return err
+		}
+		for _, user := range all {
+			if len(users) == limit {
+				break
+			}
+			if query == "" || matchesUser(user, query) {
+				users = append(users, user)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("error listing users - %s", err)
+		p.fail(rw, ErrAdminAction, nil)
+		return
+	}
+
+	p.success(rw, "", users)
+	return
+}
+
+func matchesUser(user model.User, query string) bool {
+	for _, field := range []string{user.UserID, user.Username, user.FirstName, user.LastName} {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *PageHandler) AdminGetUser(rw http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	if err := p.auditRead(r, model.VIEW_USER, userID); err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+
+	var user *model.User
+	err := p.store.View(func(tx store.Tx) error {
+		var err error
+		user, err = getUser(tx, userID)
+		return err
+	})
+	if err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+
+	p.success(rw, "", user)
+	return
+}
+
+// Transactions of a user in pages, with the same filters as /v1/transactions
+func (p *PageHandler) AdminUserTransactions(rw http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	if err := p.auditRead(r, model.VIEW_TRANSACTIONS, userID); err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+	p.pagedTransactions(rw, r, userID)
+}
+
+// Game sessions of a user with their rolls, server seeds of running games stay hidden from admins too
+func (p *PageHandler) AdminUserGames(rw http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	if err := p.auditRead(r, model.VIEW_GAMES, userID); err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+
+	games := make([]model.GameWithRolls, 0)
+	err := p.store.View(func(tx store.Tx) error {
+		if _, err := getUser(tx, userID); err != nil {
+			return err
+		}
+		sessions, err := tx.ListGameSessions(userID)
+		if err != nil {
+			log.Printf("error listing game sessions - %s", err)
+			return ErrAdminAction
+		}
+		for _, session := range sessions {
+			rolls, err := tx.ListRollSessions(session.SessionID)
+			if err != nil {
+				log.Printf("error listing roll sessions - %s", err)
+				return ErrAdminAction
+			}
+			games = append(games, model.GameWithRolls{GameSession: session.Public(), Rolls: rolls})
+		}
+		return nil
+	})
+	if err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+
+	p.success(rw, "", games)
+	return
+}
+
+func (p *PageHandler) AdminFreezeUser(rw http.ResponseWriter, r *http.Request) {
+	p.setFrozen(rw, r, true)
+}
+
+func (p *PageHandler) AdminUnfreezeUser(rw http.ResponseWriter, r *http.Request) {
+	p.setFrozen(rw, r, false)
+}
+
+func (p *PageHandler) setFrozen(rw http.ResponseWriter, r *http.Request, frozen bool) {
+	reason, err := readReason(r)
+	if err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+	action := model.FREEZE_ACCOUNT
+	if !frozen {
+		action = model.UNFREEZE_ACCOUNT
+	}
+
+	var user *model.User
+	err = p.store.Update(func(tx store.Tx) error {
+		var err error
+		user, err = getUser(tx, chi.URLParam(r, "userID"))
+		if err != nil {
+			return err
+		}
+		user.Frozen = frozen
+		if err := tx.PutUser(user); err != nil {
+			return err
+		}
+		return audit(tx, UserID(r), action, user.UserID, reason, "")
+	})
+	if err != nil {
+		p.fail(rw, adminError(err), nil)
+		return
+	}
+
+	if frozen {
+		p.success(rw, "Account frozen", user)
+	} else {
+		p.success(rw, "Account unfrozen", user)
+	}
+	return
+}
+
+// End the running games of a user, for games stuck because the player left
+func (p *PageHandler) AdminEndGame(rw http.ResponseWriter, r *http.Request) {
+	reason, err := readReason(r)
+	if err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+
+	var endedGames []model.GameSession
+	err = p.store.Update(func(tx store.Tx) error {
+		user, err := getUser(tx, chi.URLParam(r, "userID"))
+		if err != nil {
+			return err
+		}
+		endedGames, err = endGames(tx, user.UserID)
+		if err != nil {
+			return err
+		}
+		if len(endedGames) == 0 {
+			return ErrNoGameInSession
+		}
+		ids := make([]string, len(endedGames))
+		for i, game := range endedGames {
+			ids[i] = game.SessionID
+		}
+		return audit(tx, UserID(r), model.FORCE_END_GAME, user.UserID, reason, strings.Join(ids, ","))
+	})
+	if err != nil {
+		p.fail(rw, adminError(err), nil)
+		return
+	}
+
+	p.success(rw, "Game ended", endedGames)
+	return
+}
+
+// Grant bonus credit or loyalty points to a user, paid out of the promotions account
+func (p *PageHandler) AdminGrantCredit(rw http.ResponseWriter, r *http.Request) {
+	input, err := readParams(r)
+	if err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+	reason := strings.TrimSpace(input.get("reason"))
+	if reason == "" {
+		p.fail(rw, ErrReasonRequired, nil)
+		return
+	}
+	asset, err := readAsset(input)
+	if err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+	if asset != model.BONUS && asset != model.POINTS {
+		p.fail(rw, ErrAssetNotGrantable, nil)
+		return
+	}
+	amount, err := strconv.Atoi(input.get("amount"))
+	if err != nil || amount < 1 {
+		p.fail(rw, ErrInvalidAmount, nil)
+		return
+	}
+
+	var wallet *model.Wallet
+	err = p.store.Update(func(tx store.Tx) error {
+		user, err := getUser(tx, chi.URLParam(r, "userID"))
+		if err != nil {
+			return err
+		}
+		description := "Promotional credit"
+		if asset == model.POINTS {
+			description = "Loyalty points"
+		}
+		err = postWallet(tx, user, PromotionAccount, &model.Transaction{
+			Type:        model.CREDIT,
+			Reason:      model.PROMOTION,
+			Asset:       asset,
+			Description: description,
+			Amount:      amount,
+		})
+		if err != nil {
+			return err
+		}
+		if err := audit(tx, UserID(r), model.GRANT_CREDIT, user.UserID, reason, fmt.Sprintf("%d %s", amount, asset)); err != nil {
+			return err
+		}
+		wallet, err = userWallet(tx, user, "")
+		return err
+	})
+	if err != nil {
+		p.fail(rw, adminError(err), nil)
+		return
+	}
+
+	p.success(rw, "Credit granted", wallet)
+	return
+}
+
+// Audit log oldest first, userId narrows it down to actions on one user
+func (p *PageHandler) AdminAuditLog(rw http.ResponseWriter, r *http.Request) {
+	var entries []model.AuditEntry
+	err := p.store.View(func(tx store.Tx) error {
+		var err error
+		entries, err = tx.ListAuditEntries(r.URL.Query().Get("userId"))
+		return err
+	})
+	if err != nil {
+		log.Printf("error listing audit log - %s", err)
+		p.fail(rw, ErrAdminAction, nil)
+		return
+	}
+
+	p.success(rw, "", entries)
+	return
+}
+
+// SetRole changes the role of a user and records it in the audit log, actorID is the acting admin or CLIActor
+func (p *PageHandler) SetRole(actorID, userID string, role model.Role, reason string) error {
+	if role != model.PLAYER && role != model.ADMIN {
+		return ErrInvalidRole
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return ErrReasonRequired
+	}
+	return p.store.Update(func(tx store.Tx) error {
+		user, err := getUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		user.Role = role
+		if err := tx.PutUser(user); err != nil {
+			return err
+		}
+		return audit(tx, actorID, model.SET_ROLE, userID, reason, fmt.Sprintf("role %s", role))
+	})
+}
+
+// Reason for an admin action, required so the audit log explains every change
+func readReason(r *http.Request) (string, error) {
+	input, err := readParams(r)
+	if err != nil {
+		return "", err
+	}
+	reason := strings.TrimSpace(input.get("reason"))
+	if reason == "" {
+		return "", ErrReasonRequired
+	}
+	return reason, nil
+}
+
+// Record an admin action within the transaction that performs it
+func audit(tx store.Tx, actorID string, action model.AuditAction, userID, reason, detail string) error {
+	return tx.AddAuditEntry(&model.AuditEntry{
+		ID:      util.GenerateId(),
+		Action:  action,
+		ActorID: actorID,
+		UserID:  userID,
+		Reason:  reason,
+		Detail:  detail,
+		Time:    time.Now().Unix(),
+	})
+}
+
+// Record a read of player data in the audit log before it is answered. The reason is optional on reads,
+// the query string is kept as the detail so the log shows what was looked at
+func (p *PageHandler) auditRead(r *http.Request, action model.AuditAction, userID string) error {
+	err := p.store.Update(func(tx store.Tx) error {
+		return audit(tx, UserID(r), action, userID, strings.TrimSpace(r.URL.Query().Get("reason")), r.URL.RawQuery)
+	})
+	if err != nil {
+		log.Printf("error recording admin read - %s", err)
+		return ErrAdminAction
+	}
+	return nil
+}
+
+// Known errors go back to the admin as they are, store failures are logged and hidden
+func adminError(err error) error {
+	if _, ok := apiErrors[err]; ok {
+		return err
+	}
+	log.Printf("error performing admin action - %s", err)
+	return ErrAdminAction
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/promisefemi/apexnetwork-take-home/dice"
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/store"
+)
+
+// GET path on server with the API key of the caller
+func getWithKey(t *testing.T, server *httptest.Server, apiKey, path string) int {
+	req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+// Every read of player data through the admin api leaves an audit entry with the acting admin, the player and the query
+func TestAdminReadsAreAudited(t *testing.T) {
+	server, s, _, playerID := idempotentServer(t, []string{"/v1/fund-wallet"})
+	code, response := request(t, server, "", "/v1/register", `{"firstName": "Grace", "lastName": "Hopper"}`)
+	if code != http.StatusOK {
+		t.Fatalf("register - %d %s", code, response.Message)
+	}
+	var admin model.Registration
+	if err := remarshal(response.Data, &admin); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewPageHandler(s, dice.NewCryptoRoller()).SetRole(CLIActor, admin.UserID, model.ADMIN, "operator"); err != nil {
+		t.Fatal(err)
+	}
+
+	reads := []struct {
+		path   string
+		action model.AuditAction
+		userID string
+		reason string
+		detail string
+	}{
+		{"/v1/admin/users?q=ada&limit=5", model.VIEW_USERS, "", "", "q=ada&limit=5"},
+		{"/v1/admin/users/" + playerID + "?reason=ticket+42", model.VIEW_USER, playerID, "ticket 42", "reason=ticket+42"},
+		{"/v1/admin/users/" + playerID + "/transactions?type=CREDIT", model.VIEW_TRANSACTIONS, playerID, "", "type=CREDIT"},
+		{"/v1/admin/users/" + playerID + "/games", model.VIEW_GAMES, playerID, "", ""},
+		{"/v1/admin/export?userId=" + playerID + "&format=ndjson", model.EXPORT_STATEMENT, playerID, "", "userId=" + playerID + "&format=ndjson"},
+	}
+	for _, read := range reads {
+		if code := getWithKey(t, server, admin.ApiKey, read.path); code != http.StatusOK {
+			t.Fatalf("%s answered %d", read.path, code)
+		}
+	}
+
+	var entries []model.AuditEntry
+	_ = s.View(func(tx store.Tx) error {
+		var err error
+		entries, err = tx.ListAuditEntries("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nil
+	})
+	//The first entry is the role change that made the admin
+	if len(entries) != len(reads)+1 {
+		t.Fatalf("audit log holds %d entries, want %d - %+v", len(entries), len(reads)+1, entries)
+	}
+	for i, read := range reads {
+		entry := entries[i+1]
+		if entry.Action != read.action || entry.ActorID != admin.UserID || entry.UserID != read.userID || entry.Reason != read.reason || entry.Detail != read.detail {
+			t.Errorf("%s audited as %+v, want %s by %s on %q with reason %q and detail %q", read.path, entry, read.action, admin.UserID, read.userID, read.reason, read.detail)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/store"
+	"github.com/promisefemi/apexnetwork-take-home/util"
+)
+
+// Authentication settings
+const (
+	ApiKeyHeader string = "X-Api-Key"
+	ApiKeyPrefix string = "apx_"
+)
+
+// ERRORS
+var (
+	ErrUnauthorized error = errors.New("missing, invalid or expired credentials, send an API key or login token as Authorization: Bearer <token>")
+)
+
+type contextKey string
+
+const (
+	userIDContextKey      contextKey = "userID"
+	sessionHashContextKey contextKey = "sessionHash"
+	legacyContextKey      contextKey = "legacy"
+)
+
+// Authenticate resolves the player from the API key or login token of the request and stores their ID in the request context.
+// The token is read from the Authorization bearer header, or the X-Api-Key header for clients that cannot set it
+func (p *PageHandler) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(ApiKeyHeader)
+		if authorization := r.Header.Get("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+			token = strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+		}
+		if token == "" {
+			p.fail(rw, ErrUnauthorized, nil)
+			return
+		}
+
+		tokenHash := util.HashToken(token)
+		isSession := strings.HasPrefix(token, SessionPrefix)
+		var userID string
+		err := p.store.View(func(tx store.Tx) error {
+			if isSession {
+				session, err := tx.GetAuthSession(tokenHash)
+				if err != nil {
+					return err
+				}
+				if session.RevokedAt != 0 || session.ExpiresAt <= time.Now().Unix() {
+					return ErrUnauthorized
+				}
+				userID = session.UserID
+			} else {
+				apiKey, err := tx.GetApiKey(tokenHash)
+				if err != nil {
+					return err
+				}
+				userID = apiKey.UserID
+			}
+			//Tokens of removed users are worthless
+			_, err := tx.GetUser(userID)
+			return err
+		})
+		if err != nil {
+			if err != store.ErrNotFound && err != ErrUnauthorized {
+				log.Printf("error checking credentials - %s", err)
+			}
+			p.fail(rw, ErrUnauthorized, nil)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userIDContextKey, userID)
+		if isSession {
+			ctx = context.WithValue(ctx, sessionHashContextKey, tokenHash)
+		}
+		next.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
+
+// ID of the player resolved by Authenticate, empty on routes without authentication
+func UserID(r *http.Request) string {
+	userID, _ := r.Context().Value(userIDContextKey).(string)
+	return userID
+}
+
+// Token hash of the login session the request was made with, empty for API keys
+func sessionHash(r *http.Request) string {
+	tokenHash, _ := r.Context().Value(sessionHashContextKey).(string)
+	return tokenHash
+}
+
+// Issue a new API key for an existing user within an open transaction, the plain key is only returned here
+func issueApiKey(tx store.Tx, userID string) (string, error) {
+	key, err := util.GenerateToken(ApiKeyPrefix)
+	if err != nil {
+		return "", err
+	}
+	err = tx.PutApiKey(&model.ApiKey{
+		KeyHash:   util.HashToken(key),
+		UserID:    userID,
+		CreatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// IssueApiKey gives an existing user a new API key, used to hand keys to players registered before keys existed
+func (p *PageHandler) IssueApiKey(userID string) (string, error) {
+	var key string
+	err := p.store.Update(func(tx store.Tx) error {
+		if _, err := getUser(tx, userID); err != nil {
+			return err
+		}
+		var err error
+		key, err = issueApiKey(tx, userID)
+		return err
+	})
+	return key, err
+}
@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/promisefemi/apexnetwork-take-home/dice"
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/store"
+)
+
+// Hundreds of parallel requests against one player must never spend money twice or leave the ledger out of step
+func TestParallelRequestsKeepLedgerBalanced(t *testing.T) {
+	backends := map[string]func(t *testing.T) store.Store{
+		"memory": func(t *testing.T) store.Store {
+			return store.NewMemoryStore()
+		},
+		"bolt": func(t *testing.T) store.Store {
+			s, err := store.OpenBolt(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		},
+	}
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			s := open(t)
+			p := NewPageHandler(s, dice.NewCryptoRoller())
+			server := httptest.NewServer(p.Routes())
+			defer server.Close()
+
+			code, response := request(t, server, "", "/v1/register", `{"firstName": "Ada", "lastName": "Lovelace"}`)
+			if code != http.StatusOK {
+				t.Fatalf("register - %d %s", code, response.Message)
+			}
+			var registration model.Registration
+			if err := remarshal(response.Data, &registration); err != nil {
+				t.Fatal(err)
+			}
+			apiKey, userID := registration.ApiKey, registration.UserID
+			if code, response := request(t, server, apiKey, "/v1/fund-wallet", ""); code != http.StatusOK {
+				t.Fatalf("fund wallet - %d %s", code, response.Message)
+			}
+
+			//Only one of the parallel starts may open a game
+			started := parallel(50, func(int) int {
+				code, _ := request(t, server, apiKey, "/v1/start-game", "")
+				return code
+			})
+			if started[http.StatusOK] != 1 || started[http.StatusConflict] != 49 {
+				t.Fatalf("parallel starts answered %v, want one 200 and 49 409", started)
+			}
+
+			//Rolls drain the wallet while fundings top it up once it runs low
+			played := parallel(350, func(i int) int {
+				path := "/v1/roll-dice"
+				if i%7 == 0 {
+					path = "/v1/fund-wallet"
+				}
+				code, _ := request(t, server, apiKey, path, "")
+				if code == http.StatusInternalServerError {
+					t.Errorf("%s failed with 500", path)
+				}
+				return code
+			})
+			if played[http.StatusOK] == 0 {
+				t.Fatalf("parallel rolls answered %v, want some of them played", played)
+			}
+
+			err := s.View(func(tx store.Tx) error {
+				transactions, err := tx.ListTransactions(userID)
+				if err != nil {
+					return err
+				}
+				for _, transaction := range transactions {
+					if transaction.BalanceAfter != nil && *transaction.BalanceAfter < 0 {
+						t.Errorf("transaction %d left the %s balance at %d", transaction.ID, transaction.Asset, *transaction.BalanceAfter)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wallet, ledger := balances(t, s, userID); wallet < 0 || wallet != ledger {
+				t.Errorf("wallet %d and ledger %d, want the same balance of at least 0", wallet, ledger)
+			}
+
+			report, err := p.LedgerReport()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.Balanced {
+				t.Errorf("ledger is not balanced - %+v", report.Mismatches)
+			}
+			reconciled, err := p.Reconcile("", "", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(reconciled.Mismatches) != 0 {
+				t.Errorf("wallets drifted from their transactions - %+v", reconciled.Mismatches)
+			}
+		})
+	}
+}
+
+// Run fn n times at once and count the status codes it returns
+func parallel(n int, fn func(i int) int) map[int]int {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		codes = make(map[int]int)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			code := fn(i)
+			mu.Lock()
+			codes[code]++
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	return codes
+}
+
+// POST body to path on server with the API key of the player
+func request(t *testing.T, server *httptest.Server, apiKey, path, body string) (int, model.ApiResponse) {
+	req, err := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Error(err)
+		return 0, model.ApiResponse{}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Error(err)
+		return 0, model.ApiResponse{}
+	}
+	defer res.Body.Close()
+
+	var response model.ApiResponse
+	_ = json.NewDecoder(res.Body).Decode(&response)
+	return res.StatusCode, response
+}
+
+// Decode the generic data of a response into destination
+func remarshal(data any, destination any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, destination)
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/store"
+)
+
+// Statement export formats
+const (
+	ExportCSV    string = "csv"
+	ExportNDJSON string = "ndjson"
+)
+
+// ERRORS
+var (
+	ErrInvalidFormat error = errors.New("format must be csv or ndjson")
+)
+
+var statementColumns = []string{"id", "time", "time_ms", "user_id", "type", "reason", "asset", "description", "amount", "running_balance", "session_id", "roll_id", "entry_id"}
+
+// What a statement export covers
+type ExportOptions struct {
+	// Empty exports every user
+	UserID string
+	// TimeMs range, From inclusive and To exclusive, 0 is no bound
+	From   int64
+	To     int64
+	Format string
+}
+
+// Export streams the transactions of one or every user to w, oldest first, straight from a read transaction.
+// Running balances need the history before From, so that part is read but not written
+func (p *PageHandler) Export(w io.Writer, options ExportOptions) error {
+	writeLine, flush, err := statementWriter(w, options.Format)
+	if err != nil {
+		return err
+	}
+	err = p.store.View(func(tx store.Tx) error {
+		if options.UserID != "" {
+			if _, err := getUser(tx, options.UserID); err != nil {
+				return err
+			}
+		}
+		//Running balance of every user in every asset
+		running := make(map[string]int)
+		return tx.EachTransaction(options.UserID, func(transaction *model.Transaction) error {
+			key := transaction.UserID + " " + string(transaction.Asset)
+			balance := running[key]
+			switch {
+			case transaction.BalanceAfter != nil:
+				balance = *transaction.BalanceAfter
+			case transaction.Type == model.CREDIT:
+				balance += transaction.Amount
+			case transaction.Type == model.DEBIT:
+				balance -= transaction.Amount
+			}
+			running[key] = balance
+
+			if (options.From != 0 && transaction.TimeMs < options.From) || (options.To != 0 && transaction.TimeMs >= options.To) {
+				return nil
+			}
+			return writeLine(model.StatementLine{Transaction: *transaction, RunningBalance: balance})
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// Line writer and flush for a format, both write through a buffer so nothing piles up in memory
+func statementWriter(w io.Writer, format string) (func(line model.StatementLine) error, func() error, error) {
+	buffer := bufio.NewWriter(w)
+	switch format {
+	case ExportCSV:
+		writer := csv.NewWriter(buffer)
+		if err := writer.Write(statementColumns); err != nil {
+			return nil, nil, err
+		}
+		writeLine := func(line model.StatementLine) error {
+			return writer.Write([]string{
+				strconv.FormatInt(line.ID, 10),
+				time.UnixMilli(line.TimeMs).UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+				strconv.FormatInt(line.TimeMs, 10),
+				line.UserID,
+				string(line.Type),
+				string(line.Reason),
+				string(line.Asset),
+				line.Description,
+				strconv.Itoa(line.Amount),
+				strconv.Itoa(line.RunningBalance),
+				line.SessionID,
+				line.RollID,
+				line.EntryID,
+			})
+		}
+		flush := func() error {
+			writer.Flush()
+			if err := writer.Error(); err != nil {
+				return err
+			}
+			return buffer.Flush()
+		}
+		return writeLine, flush, nil
+	case ExportNDJSON:
+		encoder := json.NewEncoder(buffer)
+		writeLine := func(line model.StatementLine) error {
+			return encoder.Encode(line)
+		}
+		return writeLine, buffer.Flush, nil
+	}
+	return nil, nil, ErrInvalidFormat
+}
+
+// Statement export for accounting and support, userId narrows it to one user and from and to to a time range
+func (p *PageHandler) AdminExport(rw http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	options := ExportOptions{
+		UserID: values.Get("userId"),
+		Format: values.Get("format"),
+	}
+	if options.Format == "" {
+		options.Format = ExportCSV
+	}
+	if options.Format != ExportCSV && options.Format != ExportNDJSON {
+		p.fail(rw, ErrInvalidFormat, nil)
+		return
+	}
+	var err error
+	if options.From, err = ParseTimeMs(values.Get("from")); err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+	if options.To, err = ParseTimeMs(values.Get("to")); err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+	//Unknown users are reported before the stream starts, once it has started errors can only be logged
+	if options.UserID != "" {
+		err = p.store.View(func(tx store.Tx) error {
+			_, err := getUser(tx, options.UserID)
+			return err
+		})
+		if err != nil {
+			p.fail(rw, err, nil)
+			return
+		}
+	}
+	if err := p.auditRead(r, model.EXPORT_STATEMENT, options.UserID); err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+
+	name := "statement"
+	if options.UserID != "" {
+		name += "-" + options.UserID
+	}
+	if options.Format == ExportCSV {
+		rw.Header().Set("Content-Type", "text/csv")
+	} else {
+		rw.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	rw.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, options.Format))
+	if err := p.Export(rw, options); err != nil {
+		log.Printf("error exporting statement - %s", err)
+	}
+	return
+}
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/promisefemi/apexnetwork-take-home/game"
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/store"
+)
+
+// Game page settings
+const (
+	defaultGameLimit int = 20
+	maxGameLimit     int = 100
+)
+
+// Marker TotalGames records once every game carries its totals
+const GamesTotalledMarker string = "games-totalled"
+
+// ERRORS
+var (
+	ErrGameNotExist       error = errors.New("game does not exist")
+	ErrUnableToGetHistory error = errors.New("unable to get your game history, please contact support")
+)
+
+// Games of the player newest first in pages, each with the totals of its rounds and money. Rounds are left out, /games/{sessionID} has them
+func (p *PageHandler) Games(rw http.ResponseWriter, r *http.Request) {
+	userID := UserID(r)
+	query, err := readGameQuery(r, userID)
+	if err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+
+	page := &model.GamePage{Games: make([]model.GameSummary, 0)}
+	err = p.store.View(func(tx store.Tx) error {
+		if _, err := getUser(tx, userID); err != nil {
+			return err
+		}
+		//One game more than the limit is read to know whether another page follows
+		limit := query.Limit
+		query.Limit++
+		sessions, err := tx.QueryGameSessions(query)
+		if err != nil {
+			log.Printf("error listing game sessions - %s", err)
+			return ErrUnableToGetHistory
+		}
+		if len(sessions) > limit {
+			sessions = sessions[:limit]
+			page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(sessions[limit-1].SessionID))
+		}
+		for _, session := range sessions {
+			page.Games = append(page.Games, gameSummary(session))
+		}
+		return nil
+	})
+	if err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+
+	p.success(rw, "", page)
+	return
+}
+
+// Read limit and cursor of a page of games, the cursor holds the session ID of the last game of the previous page
+func readGameQuery(r *http.Request, userID string) (store.GameQuery, error) {
+	values := r.URL.Query()
+	query := store.GameQuery{UserID: userID, Limit: defaultGameLimit}
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return query, ErrInvalidLimit
+		}
+		if limit > maxGameLimit {
+			limit = maxGameLimit
+		}
+		query.Limit = limit
+	}
+	if cursor := values.Get("cursor"); cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil || len(raw) == 0 {
+			return query, ErrInvalidCursor
+		}
+		query.BeforeID = string(raw)
+	}
+	return query, nil
+}
+
+// One game of the player with its summary and every round in the order it was played
+func (p *PageHandler) Game(rw http.ResponseWriter, r *http.Request) {
+	userID := UserID(r)
+	sessionID := chi.URLParam(r, "sessionID")
+
+	var history model.GameHistory
+	err := p.store.View(func(tx store.Tx) error {
+		if _, err := getUser(tx, userID); err != nil {
+			return err
+		}
+		//Games of other players are reported as missing
+		session, err := tx.GetGameSession(sessionID)
+		if err != nil || session.UserId != userID {
+			return ErrGameNotExist
+		}
+		history, err = gameHistory(tx, *session)
+		if err != nil {
+			log.Printf("error listing rolls of game - %s", err)
+			return ErrUnableToGetHistory
+		}
+		return nil
+	})
+	if err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+
+	p.success(rw, "", history)
+	return
+}
+
+// Summary of a game from the totals kept on it
+func gameSummary(session model.GameSession) model.GameSummary {
+	return model.GameSummary{GameSession: session.Public(), Net: session.Won - session.Staked}
+}
+
+// Summary of a game together with its rounds
+func gameHistory(tx store.Tx, session model.GameSession) (model.GameHistory, error) {
+	rolls, err := tx.ListRollSessions(session.SessionID)
+	if err != nil {
+		return model.GameHistory{}, err
+	}
+	return model.GameHistory{GameSummary: gameSummary(session), Rolls: rolls}, nil
+}
+
+// TotalGames totals the games from before their totals were kept on the game session from their rounds and transactions,
+// returns how many were totalled. Transactions written before they carried their game are not counted.
+// Games are totalled when they start since, so once it has run it records GamesTotalledMarker and later runs return at once
+func (p *PageHandler) TotalGames() (int, error) {
+	totalled := 0
+	err := p.store.Update(func(tx store.Tx) error {
+		if _, err := tx.GetMarker(GamesTotalledMarker); err != store.ErrNotFound {
+			return err
+		}
+		users, err := tx.ListUsers()
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			sessions, err := tx.ListGameSessions(user.UserID)
+			if err != nil {
+				return err
+			}
+			pending := make(map[string]*model.GameSession)
+			for i := range sessions {
+				if !sessions[i].Totalled {
+					pending[sessions[i].SessionID] = &sessions[i]
+				}
+			}
+			if len(pending) == 0 {
+				continue
+			}
+
+			for _, session := range pending {
+				rules, err := game.Lookup(session.Rules)
+				if err != nil {
+					return err
+				}
+				rolls, err := tx.ListRollSessions(session.SessionID)
+				if err != nil {
+					return err
+				}
+				session.RollCount, session.Wins, session.Staked, session.Won = len(rolls), 0, 0, 0
+				for _, roll := range rolls {
+					if rules.Outcome(roll) == game.Won {
+						session.Wins++
+					}
+				}
+			}
+			//Every transaction of the player is read once for all of their games
+			err = tx.EachTransaction(user.UserID, func(transaction *model.Transaction) error {
+				session, ok := pending[transaction.SessionID]
+				if !ok {
+					return nil
+				}
+				switch transaction.Type {
+				case model.DEBIT:
+					session.Staked += transaction.Amount
+				case model.CREDIT:
+					session.Won += transaction.Amount
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, session := range pending {
+				session.Totalled = true
+				if err := tx.PutGameSession(session); err != nil {
+					return err
+				}
+				totalled++
+			}
+		}
+		return tx.PutMarker(GamesTotalledMarker, time.Now().Unix())
+	})
+	return totalled, err
+}
@@ -0,0 +1,285 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/promisefemi/apexnetwork-take-home/config"
+	"github.com/promisefemi/apexnetwork-take-home/dice"
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/store"
+)
+
+// GET target from handler as userID
+func get(handler http.HandlerFunc, userID, target string) (int, model.ApiResponse) {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r = r.WithContext(context.WithValue(r.Context(), userIDContextKey, userID))
+	rw := httptest.NewRecorder()
+	handler(rw, r)
+
+	var response model.ApiResponse
+	_ = json.Unmarshal(rw.Body.Bytes(), &response)
+	return rw.Code, response
+}
+
+// The totals kept on each game match its rounds and transactions, and the games come back in pages newest first without their rounds
+func TestGameTotalsAndPages(t *testing.T) {
+	s := store.NewMemoryStore()
+	p := NewPageHandler(s, dice.NewCryptoRoller())
+	economy := config.DefaultEconomy()
+	economy.FundWalletAmount = 1000
+	economy.FundWalletThreshold = 1000000
+	p.SetEconomy(economy)
+	userID := "player"
+	if err := s.Update(func(tx store.Tx) error {
+		return tx.PutUser(&model.User{UserID: userID, Asset: string(model.SAT), Role: model.PLAYER})
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var played []string
+	for i := 0; i < 5; i++ {
+		if code, response := call(p.FundWallet, userID, ""); code != http.StatusOK {
+			t.Fatalf("funding wallet - %d %s", code, response.Message)
+		}
+		code, response := call(p.StartGame, userID, "")
+		if code != http.StatusOK {
+			t.Fatalf("starting game - %d %s", code, response.Message)
+		}
+		var session model.GameSession
+		if err := remarshal(response.Data, &session); err != nil {
+			t.Fatal(err)
+		}
+		//Three rounds, the last one still waiting for its second roll when the game ends
+		for roll := 0; roll < 5; roll++ {
+			if code, response := call(p.Roll, userID, `{"stake": 7}`); code != http.StatusOK {
+				t.Fatalf("rolling - %d %s", code, response.Message)
+			}
+		}
+		if code, response := call(p.EndGame, userID, `{"sessionId": "`+session.SessionID+`"}`); code != http.StatusOK {
+			t.Fatalf("ending game - %d %s", code, response.Message)
+		}
+		played = append([]string{session.SessionID}, played...)
+	}
+
+	//Totals from the rounds and transactions, the way they were counted before they were kept
+	want := make(map[string]model.GameSession)
+	err := s.View(func(tx store.Tx) error {
+		transactions, err := tx.ListTransactions(userID)
+		if err != nil {
+			return err
+		}
+		for _, sessionID := range played {
+			totals := model.GameSession{}
+			rolls, err := tx.ListRollSessions(sessionID)
+			if err != nil {
+				return err
+			}
+			totals.RollCount = len(rolls)
+			for _, transaction := range transactions {
+				if transaction.SessionID != sessionID {
+					continue
+				}
+				if transaction.Type == model.DEBIT {
+					totals.Staked += transaction.Amount
+				} else {
+					totals.Won += transaction.Amount
+					totals.Wins++
+				}
+			}
+			want[sessionID] = totals
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var listed []string
+	target := "/v1/games?limit=2"
+	for pages := 0; target != ""; pages++ {
+		if pages == 3 {
+			t.Fatalf("more than 3 pages of 2 for 5 games")
+		}
+		code, response := get(p.Games, userID, target)
+		if code != http.StatusOK {
+			t.Fatalf("listing games - %d %s", code, response.Message)
+		}
+		raw, _ := json.Marshal(response.Data)
+		var page model.GamePage
+		var fields struct {
+			Games []map[string]any `json:"games"`
+		}
+		if err := json.Unmarshal(raw, &page); err != nil {
+			t.Fatal(err)
+		}
+		_ = json.Unmarshal(raw, &fields)
+		for i, summary := range page.Games {
+			if _, ok := fields.Games[i]["rolls"]; ok {
+				t.Errorf("game list carries rolls")
+			}
+			totals := want[summary.SessionID]
+			if summary.RollCount != totals.RollCount || summary.Wins != totals.Wins || summary.Staked != totals.Staked || summary.Won != totals.Won ||
+				summary.Net != totals.Won-totals.Staked {
+				t.Errorf("game %s totals %+v, want %+v", summary.SessionID, summary, totals)
+			}
+			listed = append(listed, summary.SessionID)
+		}
+		target = ""
+		if page.NextCursor != "" {
+			target = "/v1/games?limit=2&cursor=" + page.NextCursor
+		}
+	}
+	if len(listed) != len(played) {
+		t.Fatalf("listed %v, want %v", listed, played)
+	}
+	for i := range played {
+		if listed[i] != played[i] {
+			t.Fatalf("listed %v, want %v newest first", listed, played)
+		}
+	}
+
+	if code, _ := get(p.Games, userID, "/v1/games?cursor=!"); code != http.StatusBadRequest {
+		t.Errorf("invalid cursor answered %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+// Games from before their totals were kept are totalled once from their rounds and transactions
+func TestTotalGames(t *testing.T) {
+	s := store.NewMemoryStore()
+	p := NewPageHandler(s, dice.NewCryptoRoller())
+	err := s.Update(func(tx store.Tx) error {
+		if err := tx.PutUser(&model.User{UserID: "player", Asset: string(model.SAT), Role: model.PLAYER}); err != nil {
+			return err
+		}
+		if err := tx.PutGameSession(&model.GameSession{SessionID: "old", UserId: "player", GameStatus: model.COMPLETED}); err != nil {
+			return err
+		}
+		for _, roll := range []model.RollSession{
+			{RollID: "1", GameSessionID: "old", WinningGame: 7, FirstRoll: 3, SecondRoll: 4, RowStatus: model.COMPLETED},
+			{RollID: "2", GameSessionID: "old", WinningGame: 7, FirstRoll: 3, SecondRoll: 5, RowStatus: model.COMPLETED},
+		} {
+			roll := roll
+			if err := tx.PutRollSession(&roll); err != nil {
+				return err
+			}
+		}
+		for _, transaction := range []model.Transaction{
+			{UserID: "player", Type: model.DEBIT, Amount: 20, SessionID: "old"},
+			{UserID: "player", Type: model.DEBIT, Amount: 5, SessionID: "old"},
+			{UserID: "player", Type: model.DEBIT, Amount: 5, SessionID: "old"},
+			{UserID: "player", Type: model.CREDIT, Amount: 20, SessionID: "old"},
+			{UserID: "player", Type: model.DEBIT, Amount: 20, SessionID: "other"},
+		} {
+			transaction := transaction
+			if err := tx.AddTransaction(&transaction); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for run, want := range []int{1, 0} {
+		totalled, err := p.TotalGames()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if totalled != want {
+			t.Errorf("run %d totalled %d games, want %d", run, totalled, want)
+		}
+	}
+
+	//Once done the games are not read again, not even one written without totals
+	err = s.Update(func(tx store.Tx) error {
+		return tx.PutGameSession(&model.GameSession{SessionID: "later", UserId: "player", GameStatus: model.COMPLETED})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totalled, err := p.TotalGames(); err != nil || totalled != 0 {
+		t.Errorf("run after the marker totalled %d games, want 0 - %v", totalled, err)
+	}
+	_ = s.View(func(tx store.Tx) error {
+		session, err := tx.GetGameSession("old")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.RollCount != 2 || session.Wins != 1 || session.Staked != 30 || session.Won != 20 || !session.Totalled {
+			t.Errorf("totals %+v, want 2 rounds, 1 win, 30 staked and 20 won", session)
+		}
+		return nil
+	})
+}
+
+// Ending a game settles it from the totals kept on it, the transactions of the player are not read inside the write transaction
+func TestEndGameSettlesFromTotals(t *testing.T) {
+	s := &failingStore{Store: store.NewMemoryStore(), failOn: "EachTransaction"}
+	p := NewPageHandler(s, dice.NewCryptoRoller())
+	userID := "player"
+	if err := s.Update(func(tx store.Tx) error {
+		return tx.PutUser(&model.User{UserID: userID, Asset: string(model.SAT), Role: model.PLAYER})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if code, response := call(p.FundWallet, userID, ""); code != http.StatusOK {
+		t.Fatalf("funding wallet - %d %s", code, response.Message)
+	}
+	code, response := call(p.StartGame, userID, "")
+	if code != http.StatusOK {
+		t.Fatalf("starting game - %d %s", code, response.Message)
+	}
+	var session model.GameSession
+	if err := remarshal(response.Data, &session); err != nil {
+		t.Fatal(err)
+	}
+	//Rounds of two rolls or of one when the first die leaves the target out of reach, the last may still wait for its second roll
+	for roll := 0; roll < 3; roll++ {
+		if code, response := call(p.Roll, userID, `{"stake": 3}`); code != http.StatusOK {
+			t.Fatalf("rolling - %d %s", code, response.Message)
+		}
+	}
+
+	code, response = call(p.EndGame, userID, `{"sessionId": "`+session.SessionID+`"}`)
+	if code != http.StatusOK {
+		t.Fatalf("ending game - %d %s", code, response.Message)
+	}
+	var settlement model.GameSettlement
+	if err := remarshal(response.Data, &settlement); err != nil {
+		t.Fatal(err)
+	}
+
+	var rounds, staked, won int
+	_ = s.View(func(tx store.Tx) error {
+		rolls, err := tx.ListRollSessions(session.SessionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rounds = len(rolls)
+		transactions, err := tx.ListTransactions(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, transaction := range transactions {
+			switch {
+			case transaction.SessionID != session.SessionID:
+			case transaction.Type == model.DEBIT:
+				staked += transaction.Amount
+			default:
+				won += transaction.Amount
+			}
+		}
+		return nil
+	})
+	if settlement.RollCount != rounds || settlement.Staked != staked || settlement.Won != won || settlement.Net != won-staked {
+		t.Errorf("settlement %+v, want %d rounds, %d staked and %d won", settlement.GameSummary, rounds, staked, won)
+	}
+	if settlement.GameStatus != model.COMPLETED || settlement.ServerSeed == "" {
+		t.Errorf("settlement did not end the game and reveal its seed - %+v", settlement.GameSession)
+	}
+}
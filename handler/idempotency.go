@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/store"
+)
+
+// Idempotency settings
+const (
+	IdempotencyHeader    string        = "Idempotency-Key"
+	IdempotencyRetention time.Duration = 24 * time.Hour
+	maxIdempotentBody    int64         = 1 << 20
+)
+
+// ERRORS
+var (
+	ErrIdempotencyKeyReused     error = errors.New("idempotency key was already used with a different request")
+	ErrIdempotencyKeyInProgress error = errors.New("a request with this idempotency key is still being processed, retry later")
+	ErrRequestTooLarge          error = errors.New("request body is too large")
+	ErrUnableToProcess          error = errors.New("unable to process request, please contact support")
+)
+
+// Idempotent replays the stored response when a request is retried with the same Idempotency-Key.
+// The key is reserved before the handler runs, so a retry arriving while the first attempt is running,
+// or after it crashed half way, is rejected instead of being applied twice.
+func (p *PageHandler) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyHeader)
+		if key == "" {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBody+1))
+		if err != nil || int64(len(body)) > maxIdempotentBody {
+			p.fail(rw, ErrRequestTooLarge, nil)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		//Keys are scoped to the player and the endpoint, the hash covers everything that makes up the request payload
+		scopedKey := UserID(r) + " " + r.Method + " " + r.URL.Path + " " + key
+		hash := sha256.New()
+		for _, part := range []string{r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get("Content-Type")} {
+			hash.Write([]byte(part))
+			hash.Write([]byte{0})
+		}
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		var replay *model.IdempotencyRecord
+		now := time.Now()
+		err = p.store.Update(func(tx store.Tx) error {
+			record, err := tx.GetIdempotencyRecord(scopedKey)
+			if err != nil && err != store.ErrNotFound {
+				return err
+			}
+			//Expired records are treated as if the key was never used
+			if record != nil && now.Sub(time.Unix(record.CreatedAt, 0)) < IdempotencyRetention {
+				if record.RequestHash != requestHash {
+					return ErrIdempotencyKeyReused
+				}
+				if record.StatusCode == 0 {
+					return ErrIdempotencyKeyInProgress
+				}
+				replay = record
+				return nil
+			}
+			return tx.PutIdempotencyRecord(&model.IdempotencyRecord{
+				Key:         scopedKey,
+				RequestHash: requestHash,
+				CreatedAt:   now.Unix(),
+			})
+		})
+		switch {
+		case err == ErrIdempotencyKeyReused, err == ErrIdempotencyKeyInProgress:
+			p.fail(rw, err, nil)
+			return
+		case err != nil:
+			log.Printf("error reserving idempotency key - %s", err)
+			p.fail(rw, ErrUnableToProcess, nil)
+			return
+		}
+
+		if replay != nil {
+			rw.Header().Set("Content-Type", "application/json")
+			rw.Header().Set("Idempotent-Replayed", "true")
+			rw.WriteHeader(replay.StatusCode)
+			_, _ = rw.Write(replay.Body)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: rw, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		err = p.store.Update(func(tx store.Tx) error {
+			//Server errors release the key so the request can be retried
+			if recorder.status >= http.StatusInternalServerError {
+				return tx.DeleteIdempotencyRecord(scopedKey)
+			}
+			return tx.PutIdempotencyRecord(&model.IdempotencyRecord{
+				Key:         scopedKey,
+				RequestHash: requestHash,
+				StatusCode:  recorder.status,
+				Body:        recorder.body.Bytes(),
+				CreatedAt:   now.Unix(),
+			})
+		})
+		if err != nil {
+			log.Printf("error saving idempotent response - %s", err)
+		}
+	})
+}
+
+// Remove idempotency records older than the retention window
+func (p *PageHandler) PruneIdempotencyKeys() (int, error) {
+	var removed int
+	err := p.store.Update(func(tx store.Tx) error {
+		var err error
+		removed, err = tx.DeleteIdempotencyRecords(time.Now().Add(-IdempotencyRetention).Unix())
+		return err
+	})
+	return removed, err
+}
+
+// responseRecorder keeps a copy of the response while writing it through
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
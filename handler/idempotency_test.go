@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/promisefemi/apexnetwork-take-home/dice"
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/store"
+)
+
+// An idempotent endpoint, how to bring a new player to where it can be called, and the body of a request to it
+var idempotentEndpoints = []struct {
+	path  string
+	setup []string
+	body  string
+	other string
+}{
+	{"/v1/fund-wallet", nil, ``, `{"asset": "sat"}`},
+	{"/v1/start-game", []string{"/v1/fund-wallet"}, ``, `{"clientSeed": "other"}`},
+	//The unkeyed roll quotes the round, the keyed one takes the stake and settles it
+	{"/v1/roll-dice", []string{"/v1/fund-wallet", "/v1/start-game", "/v1/roll-dice"}, `{"stake": 10}`, `{"stake": 9}`},
+}
+
+// Server for a new store with a registered player brought through setup, returns the server, its store, the API key and the user ID
+func idempotentServer(t *testing.T, setup []string) (*httptest.Server, store.Store, string, string) {
+	t.Helper()
+	s := store.NewMemoryStore()
+	//Target 4 and a first die of 2, the second roll wins on the 2 after a 5 and a 4
+	p := NewPageHandler(s, dice.NewSequenceRoller(4, 2, 5))
+	server := httptest.NewServer(p.Routes())
+	t.Cleanup(server.Close)
+
+	code, response := request(t, server, "", "/v1/register", `{"firstName": "Ada", "lastName": "Lovelace"}`)
+	if code != http.StatusOK {
+		t.Fatalf("register - %d %s", code, response.Message)
+	}
+	var registration model.Registration
+	if err := remarshal(response.Data, &registration); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range setup {
+		if code, response := request(t, server, registration.ApiKey, path, `{"stake": 10}`); code != http.StatusOK {
+			t.Fatalf("%s - %d %s", path, code, response.Message)
+		}
+	}
+	return server, s, registration.ApiKey, registration.UserID
+}
+
+// POST body to path on server with the API key of the player and an Idempotency-Key, returns the raw response
+func keyed(t *testing.T, server *httptest.Server, apiKey, key, path, body string) (int, []byte, http.Header) {
+	req, err := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Error(err)
+		return 0, nil, nil
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set(IdempotencyHeader, key)
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Error(err)
+		return 0, nil, nil
+	}
+	defer res.Body.Close()
+	raw, _ := io.ReadAll(res.Body)
+	return res.StatusCode, raw, res.Header
+}
+
+// Transactions of userID and their sat balance
+func moneyOf(t *testing.T, s store.Store, userID string) (int, int) {
+	t.Helper()
+	var count, wallet int
+	_ = s.View(func(tx store.Tx) error {
+		transactions, err := tx.ListTransactions(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		user, err := tx.GetUser(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, wallet = len(transactions), user.Wallet
+		return nil
+	})
+	return count, wallet
+}
+
+// A retry with the same key gets the stored response back without the request being applied again,
+// a different payload under the same key is rejected
+func TestIdempotentReplay(t *testing.T) {
+	for _, endpoint := range idempotentEndpoints {
+		t.Run(endpoint.path, func(t *testing.T) {
+			server, s, apiKey, userID := idempotentServer(t, endpoint.setup)
+
+			code, first, _ := keyed(t, server, apiKey, "key-1", endpoint.path, endpoint.body)
+			if code != http.StatusOK {
+				t.Fatalf("first request - %d %s", code, first)
+			}
+			transactions, wallet := moneyOf(t, s, userID)
+
+			code, replayed, header := keyed(t, server, apiKey, "key-1", endpoint.path, endpoint.body)
+			if code != http.StatusOK || string(replayed) != string(first) || header.Get("Idempotent-Replayed") != "true" {
+				t.Errorf("retry answered %d %s, want the stored 200 %s replayed", code, replayed, first)
+			}
+			if replayedTransactions, replayedWallet := moneyOf(t, s, userID); replayedTransactions != transactions || replayedWallet != wallet {
+				t.Errorf("retry left %d transactions and wallet %d, want %d and %d", replayedTransactions, replayedWallet, transactions, wallet)
+			}
+
+			code, raw, _ := keyed(t, server, apiKey, "key-1", endpoint.path, endpoint.other)
+			var response model.ApiResponse
+			_ = json.Unmarshal(raw, &response)
+			if code != http.StatusUnprocessableEntity || response.Code != CodeIdempotencyReused {
+				t.Errorf("different payload answered %d %s, want %d %s", code, raw, http.StatusUnprocessableEntity, CodeIdempotencyReused)
+			}
+			if reusedTransactions, reusedWallet := moneyOf(t, s, userID); reusedTransactions != transactions || reusedWallet != wallet {
+				t.Errorf("reused key left %d transactions and wallet %d, want %d and %d", reusedTransactions, reusedWallet, transactions, wallet)
+			}
+		})
+	}
+}
+
+// Requests racing with the same key are applied once, the others get the stored response or are told to retry
+func TestIdempotentConcurrentRequests(t *testing.T) {
+	for _, endpoint := range idempotentEndpoints {
+		t.Run(endpoint.path, func(t *testing.T) {
+			server, s, apiKey, userID := idempotentServer(t, endpoint.setup)
+			transactions, wallet := moneyOf(t, s, userID)
+
+			bodies := make(chan string, 20)
+			codes := parallel(20, func(int) int {
+				code, raw, _ := keyed(t, server, apiKey, "key-1", endpoint.path, endpoint.body)
+				if code == http.StatusOK {
+					bodies <- string(raw)
+				}
+				return code
+			})
+			close(bodies)
+			if codes[http.StatusOK] == 0 || codes[http.StatusOK]+codes[http.StatusConflict] != 20 {
+				t.Fatalf("racing requests answered %v, want only 200 and 409", codes)
+			}
+			var first string
+			for body := range bodies {
+				if first == "" {
+					first = body
+				}
+				if body != first {
+					t.Errorf("racing requests answered %s and %s, want the same response", first, body)
+				}
+			}
+
+			//Applied once, the money moves as it does for a single request from a player set up the same way
+			single, singleStore, singleKey, singleID := idempotentServer(t, endpoint.setup)
+			singleTransactions, singleWallet := moneyOf(t, singleStore, singleID)
+			if code, raw, _ := keyed(t, single, singleKey, "key-1", endpoint.path, endpoint.body); code != http.StatusOK {
+				t.Fatalf("single request - %d %s", code, raw)
+			}
+			wantTransactions, wantWallet := moneyOf(t, singleStore, singleID)
+			racedTransactions, racedWallet := moneyOf(t, s, userID)
+			if racedTransactions-transactions != wantTransactions-singleTransactions || racedWallet-wallet != wantWallet-singleWallet {
+				t.Errorf("racing requests added %d transactions and moved the wallet by %d, want %d and %d",
+					racedTransactions-transactions, racedWallet-wallet, wantTransactions-singleTransactions, wantWallet-singleWallet)
+			}
+		})
+	}
+}
+
+// Keys are forgotten once they fall out of the retention window, the same key then runs a new request
+func TestIdempotencyKeysPruned(t *testing.T) {
+	server, s, apiKey, userID := idempotentServer(t, nil)
+	if code, raw, _ := keyed(t, server, apiKey, "old", "/v1/fund-wallet", ""); code != http.StatusOK {
+		t.Fatalf("funding wallet - %d %s", code, raw)
+	}
+	if code, raw, _ := keyed(t, server, apiKey, "new", "/v1/start-game", ""); code != http.StatusOK {
+		t.Fatalf("starting game - %d %s", code, raw)
+	}
+
+	//Age the first key past the retention window
+	oldKey := userID + " " + http.MethodPost + " /v1/fund-wallet old"
+	err := s.Update(func(tx store.Tx) error {
+		record, err := tx.GetIdempotencyRecord(oldKey)
+		if err != nil {
+			return err
+		}
+		record.CreatedAt = time.Now().Add(-IdempotencyRetention - time.Minute).Unix()
+		return tx.PutIdempotencyRecord(record)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPageHandler(s, dice.NewCryptoRoller())
+	removed, err := p.PruneIdempotencyKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("pruned %d keys, want the 1 past the retention window", removed)
+	}
+	_ = s.View(func(tx store.Tx) error {
+		if _, err := tx.GetIdempotencyRecord(oldKey); err != store.ErrNotFound {
+			t.Errorf("pruned key returned %v, want %v", err, store.ErrNotFound)
+		}
+		if _, err := tx.GetIdempotencyRecord(userID + " " + http.MethodPost + " /v1/start-game new"); err != nil {
+			t.Errorf("key inside the retention window was pruned - %s", err)
+		}
+		return nil
+	})
+
+	//A different payload under the pruned key is a new request
+	code, raw, header := keyed(t, server, apiKey, "old", "/v1/fund-wallet", `{"asset": "sat"}`)
+	var response model.ApiResponse
+	_ = json.Unmarshal(raw, &response)
+	if response.Code == CodeIdempotencyReused || header.Get("Idempotent-Replayed") != "" {
+		t.Errorf("pruned key answered %d %s, want the request run again", code, raw)
+	}
+}
@@ -0,0 +1,299 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/store"
+	"github.com/promisefemi/apexnetwork-take-home/util"
+)
+
+// Ledger accounts, every player also has a wallet account named by WalletAccount
+const (
+	// Takes stakes and pays out winnings, its balance is the house profit
+	HouseAccount string = "house"
+	// Source of wallet funding, goes negative by everything players have put in
+	FundingAccount string = "funding"
+	// Counter account of the balances players already had when the ledger was introduced
+	OpeningAccount string = "opening"
+	// Source of the bonus credit and loyalty points granted by admins
+	PromotionAccount string = "promotions"
+
+	walletAccountPrefix string = "wallet:"
+)
+
+// Ledger account of asset, sat accounts keep the plain names they had before other assets existed
+func AssetAccount(account string, asset model.Asset) string {
+	if asset == model.SAT || asset == "" {
+		return account
+	}
+	return account + ":" + string(asset)
+}
+
+// Ledger account holding the balance of user in asset
+func WalletAccount(userID string, asset model.Asset) string {
+	return AssetAccount(walletAccountPrefix+userID, asset)
+}
+
+// Move transaction.Amount of transaction.Asset between the wallet of user and counterAccount, CREDIT moves money into the wallet and DEBIT takes it out.
+// The caller fills in type, reason, asset, amount, description and the game or roll it belongs to. Writes the balanced journal entry,
+// sets the sat wallet from its account and records the transaction the player sees. Must run inside the write transaction of the caller
+func postWallet(tx store.Tx, user *model.User, counterAccount string, transaction *model.Transaction) error {
+	if err := openWallet(tx, user); err != nil {
+		return err
+	}
+	if transaction.Asset == "" {
+		transaction.Asset = model.SAT
+	}
+
+	wallet := WalletAccount(user.UserID, transaction.Asset)
+	counterAccount = AssetAccount(counterAccount, transaction.Asset)
+	movement := transaction.Amount
+	if transaction.Type == model.DEBIT {
+		movement = -movement
+	}
+	now := time.Now()
+	entry := &model.JournalEntry{
+		ID:          util.GenerateId(),
+		Time:        now.Unix(),
+		Description: transaction.Description,
+		Postings: []model.Posting{
+			{Account: wallet, Amount: movement},
+			{Account: counterAccount, Amount: -movement},
+		},
+	}
+	if err := tx.AddJournalEntry(entry); err != nil {
+		return err
+	}
+
+	balance, err := tx.GetAccountBalance(wallet)
+	if err != nil {
+		return err
+	}
+	if transaction.Asset == model.SAT {
+		user.Wallet = balance
+	}
+
+	transaction.UserID = user.UserID
+	transaction.Time = now.Unix()
+	transaction.TimeMs = now.UnixMilli()
+	transaction.EntryID = entry.ID
+	transaction.BalanceAfter = &balance
+	if err := tx.AddTransaction(transaction); err != nil {
+		return err
+	}
+	return tx.PutUser(user)
+}
+
+// Take a cost from the wallet of user, sat costs are paid with bonus credit first and real funds for the rest.
+// Callers check spendableBalance before, this writes one transaction per asset it takes from
+func chargeWallet(tx store.Tx, user *model.User, counterAccount string, transaction model.Transaction) error {
+	if transaction.Asset == model.SAT {
+		bonus, err := assetBalance(tx, user, model.BONUS)
+		if err != nil {
+			return err
+		}
+		if bonus > 0 {
+			fromBonus := transaction
+			fromBonus.Asset = model.BONUS
+			if fromBonus.Amount > bonus {
+				fromBonus.Amount = bonus
+			}
+			if err := postWallet(tx, user, counterAccount, &fromBonus); err != nil {
+				return err
+			}
+			transaction.Amount -= fromBonus.Amount
+			if transaction.Amount == 0 {
+				return nil
+			}
+		}
+	}
+	return postWallet(tx, user, counterAccount, &transaction)
+}
+
+// Balance of user in asset, wallets that never moved hold nothing except legacy sat balances
+func assetBalance(tx store.Tx, user *model.User, asset model.Asset) (int, error) {
+	if asset == model.SAT {
+		return user.Wallet, nil
+	}
+	balance, err := tx.GetAccountBalance(WalletAccount(user.UserID, asset))
+	if err == store.ErrNotFound {
+		return 0, nil
+	}
+	return balance, err
+}
+
+// What user can pay a cost in asset with, bonus credit counts towards sat costs
+func spendableBalance(tx store.Tx, user *model.User, asset model.Asset) (int, error) {
+	balance, err := assetBalance(tx, user, asset)
+	if err != nil || asset != model.SAT {
+		return balance, err
+	}
+	bonus, err := assetBalance(tx, user, model.BONUS)
+	return balance + bonus, err
+}
+
+// User with their balance in every asset, or only in asset when it is set
+func userWallet(tx store.Tx, user *model.User, asset model.Asset) (*model.Wallet, error) {
+	wallet := &model.Wallet{User: *user, Balances: make([]model.AssetBalance, 0, len(model.Assets))}
+	for _, a := range model.Assets {
+		if asset != "" && a != asset {
+			continue
+		}
+		balance, err := assetBalance(tx, user, a)
+		if err != nil {
+			return nil, err
+		}
+		wallet.Balances = append(wallet.Balances, model.AssetBalance{Asset: a, Balance: balance})
+	}
+	return wallet, nil
+}
+
+// Players whose wallet was funded before the ledger existed get their balance posted as an opening entry,
+// the first time their wallet moves or when OpenWallets runs
+func openWallet(tx store.Tx, user *model.User) error {
+	wallet := WalletAccount(user.UserID, model.SAT)
+	if _, err := tx.GetAccountBalance(wallet); err != store.ErrNotFound {
+		return err
+	}
+	if user.Wallet == 0 {
+		return nil
+	}
+	return tx.AddJournalEntry(&model.JournalEntry{
+		ID:          util.GenerateId(),
+		Time:        time.Now().Unix(),
+		Description: "Opening balance",
+		Postings: []model.Posting{
+			{Account: wallet, Amount: user.Wallet},
+			{Account: OpeningAccount, Amount: -user.Wallet},
+		},
+	})
+}
+
+// OpenWallets posts the opening entry of every user with a balance but no wallet account yet, returns how many were opened
+func (p *PageHandler) OpenWallets() (int, error) {
+	opened := 0
+	err := p.store.Update(func(tx store.Tx) error {
+		users, err := tx.ListUsers()
+		if err != nil {
+			return err
+		}
+		for i := range users {
+			if _, err := tx.GetAccountBalance(WalletAccount(users[i].UserID, model.SAT)); err != store.ErrNotFound || users[i].Wallet == 0 {
+				continue
+			}
+			if err := openWallet(tx, &users[i]); err != nil {
+				return err
+			}
+			opened++
+		}
+		return nil
+	})
+	return opened, err
+}
+
+// LedgerReport checks the ledger and reports the house profit and loss in every asset
+func (p *PageHandler) LedgerReport() (*model.LedgerReport, error) {
+	report := &model.LedgerReport{
+		Time:       time.Now().Unix(),
+		Mismatches: make([]model.LedgerMismatch, 0),
+	}
+	/*
+		. Every account balance must equal the sum of its postings
+		. All accounts together must sum to zero
+		. Every user wallet must equal the balance of its wallet account
+	*/
+	err := p.store.View(func(tx store.Tx) error {
+		var err error
+		report.Accounts, err = tx.ListAccountBalances()
+		if err != nil {
+			return err
+		}
+
+		total := 0
+		balances := make(map[string]int, len(report.Accounts))
+		for _, account := range report.Accounts {
+			total += account.Balance
+			balances[account.Account] = account.Balance
+
+			entries, err := tx.ListJournalEntries(account.Account)
+			if err != nil {
+				return err
+			}
+			posted := 0
+			for _, entry := range entries {
+				for _, posting := range entry.Postings {
+					if posting.Account == account.Account {
+						posted += posting.Amount
+					}
+				}
+			}
+			if posted != account.Balance {
+				mismatch := model.LedgerMismatch{
+					Account:  account.Account,
+					Expected: posted,
+					Actual:   account.Balance,
+					Problem:  "account balance differs from the sum of its postings",
+				}
+				if strings.HasPrefix(account.Account, walletAccountPrefix) {
+					mismatch.UserID, _, _ = strings.Cut(strings.TrimPrefix(account.Account, walletAccountPrefix), ":")
+				}
+				report.Mismatches = append(report.Mismatches, mismatch)
+			}
+		}
+		if total != 0 {
+			report.Mismatches = append(report.Mismatches, model.LedgerMismatch{
+				Expected: 0,
+				Actual:   total,
+				Problem:  "accounts do not sum to zero",
+			})
+		}
+
+		users, err := tx.ListUsers()
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			wallet := WalletAccount(user.UserID, model.SAT)
+			if balance := balances[wallet]; balance != user.Wallet {
+				report.Mismatches = append(report.Mismatches, model.LedgerMismatch{
+					Account:  wallet,
+					UserID:   user.UserID,
+					Expected: balance,
+					Actual:   user.Wallet,
+					Problem:  fmt.Sprintf("user wallet is %d but the wallet account holds %d", user.Wallet, balance),
+				})
+			}
+		}
+
+		report.HouseProfit = balances[HouseAccount]
+		report.HouseProfitByAsset = make([]model.AssetBalance, 0, len(model.Assets))
+		for _, asset := range model.Assets {
+			report.HouseProfitByAsset = append(report.HouseProfitByAsset, model.AssetBalance{Asset: asset, Balance: balances[AssetAccount(HouseAccount, asset)]})
+		}
+		report.TotalFunded = -balances[FundingAccount]
+		report.Balanced = len(report.Mismatches) == 0
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Ledger report for the finance team
+func (p *PageHandler) AdminLedger(rw http.ResponseWriter, r *http.Request) {
+	report, err := p.LedgerReport()
+	if err != nil {
+		log.Printf("error building ledger report - %s", err)
+		p.fail(rw, ErrAdminAction, nil)
+		return
+	}
+
+	p.success(rw, "", report)
+	return
+}
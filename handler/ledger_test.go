@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/promisefemi/apexnetwork-take-home/dice"
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/store"
+)
+
+// Stakes paid with bonus credit show up as house profit in bonus, the sat profit only counts sat
+func TestLedgerReportsHouseProfitPerAsset(t *testing.T) {
+	s := store.NewMemoryStore()
+	p := NewPageHandler(s, dice.NewCryptoRoller())
+	user := &model.User{UserID: "player", Asset: string(model.SAT), Role: model.PLAYER}
+	err := s.Update(func(tx store.Tx) error {
+		if err := tx.PutUser(user); err != nil {
+			return err
+		}
+		for _, grant := range []struct {
+			account string
+			asset   model.Asset
+			amount  int
+		}{{FundingAccount, model.SAT, 100}, {PromotionAccount, model.BONUS, 12}} {
+			err := postWallet(tx, user, grant.account, &model.Transaction{Type: model.CREDIT, Asset: grant.asset, Amount: grant.amount, Description: "Funding"})
+			if err != nil {
+				return err
+			}
+		}
+		//12 of the stake come out of bonus and 8 out of sat, 5 sat are won back
+		err := chargeWallet(tx, user, HouseAccount, model.Transaction{Type: model.DEBIT, Reason: model.ROLL_STAKE, Asset: model.SAT, Amount: 20, Description: "Rolled dice"})
+		if err != nil {
+			return err
+		}
+		return postWallet(tx, user, HouseAccount, &model.Transaction{Type: model.CREDIT, Reason: model.WIN_PAYOUT, Asset: model.SAT, Amount: 5, Description: "Winnings"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := p.LedgerReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Balanced {
+		t.Errorf("ledger is not balanced - %+v", report.Mismatches)
+	}
+	want := []model.AssetBalance{{Asset: model.SAT, Balance: 3}, {Asset: model.BONUS, Balance: 12}, {Asset: model.POINTS, Balance: 0}}
+	if report.HouseProfit != 3 || !reflect.DeepEqual(report.HouseProfitByAsset, want) {
+		t.Errorf("house profit %d and per asset %+v, want 3 and %+v", report.HouseProfit, report.HouseProfitByAsset, want)
+	}
+}
@@ -1,885 +1,922 @@
 package handler
 
 import (
-	"encoding/json"
 	"errors"
-	"fmt"
-	"github.com/boltdb/bolt"
+	"github.com/promisefemi/apexnetwork-take-home/config"
+	"github.com/promisefemi/apexnetwork-take-home/dice"
+	"github.com/promisefemi/apexnetwork-take-home/game"
 	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/store"
 	"github.com/promisefemi/apexnetwork-take-home/util"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
-// Constants
+// Asset each cost and payout is in, sat costs are paid with bonus credit first
 const (
-	UserBucket        string = "users"
-	TransactionBucket string = "transactions"
-	GameSessionBucket string = "gameSession"
-	RollSessionBucket string = "rollSession"
-
-	GameStartCost    int = 20
-	FirstRowCost     int = 5
-	WinningAmount    int = 20
-	FundWalletAmount int = 155
+	GameStartAsset  model.Asset = model.SAT
+	FirstRowAsset   model.Asset = model.SAT
+	WinningAsset    model.Asset = model.SAT
+	FundWalletAsset model.Asset = model.SAT
 )
 
 // ERRORS
 var (
-	ErrUserNotExist            error = errors.New("user does not exist, kindly create user account ")
-	ErrUnableToFundWallet      error = errors.New("unable to fund your wallet, please contact support")
-	ErrNoTransactionsAvailable error = errors.New("no transactions available")
-	ErrUnableToStartGame       error = errors.New("unable to start game, please contact support")
-	ErrGameInSession           error = errors.New("you already have an active game in progress, end previous game to start another ")
-	ErrNoGameInSession         error = errors.New("you have no active game in progress, please start a new game ")
-	ErrUnableToRollDice        error = errors.New("unable to roll dice, please contact support ")
-	ErrNoActiveRollSession     error = errors.New("no roll session active ")
-	ErrUnableToEndGame         error = errors.New("unable to end game, please contact support ")
+	ErrUserNotExist             error = errors.New("user does not exist, kindly create user account ")
+	ErrUnableToFundWallet       error = errors.New("unable to fund your wallet, please contact support")
+	ErrNoTransactionsAvailable  error = errors.New("no transactions available")
+	ErrUnableToStartGame        error = errors.New("unable to start game, please contact support")
+	ErrGameInSession            error = errors.New("you already have an active game in progress, end previous game to start another ")
+	ErrNoGameInSession          error = errors.New("you have no active game in progress, please start a new game ")
+	ErrUnableToRollDice         error = errors.New("unable to roll dice, please contact support ")
+	ErrNoActiveRollSession      error = errors.New("no roll session active ")
+	ErrUnableToEndGame          error = errors.New("unable to end game, please contact support ")
+	ErrInsufficientFundsToStart error = errors.New("you do not have enough funds to start the game, please fund your account")
+	ErrInsufficientFundsToRoll  error = errors.New("you do not have enough funds to roll dice, please fund your account")
+	ErrFundingNotAllowed        error = errors.New("unfortunately you cannot fund your wallet until its balance runs low")
+	ErrRollNotExist             error = errors.New("roll does not exist")
+	ErrSeedNotRevealed          error = errors.New("server seed is revealed once the game has ended, end the game to verify this roll")
+	ErrRollNotVerifiable        error = errors.New("roll was played before provably fair seeds were introduced")
+	ErrInvalidVerifyRequest     error = errors.New("please enter a roll ID, or a server seed, client seed and nonce")
+	ErrAccountFrozen            error = errors.New("your account is frozen, please contact support")
+	ErrInvalidAsset             error = errors.New("asset must be sat, bonus or points")
+	ErrAssetNotFundable         error = errors.New("only sat can be funded, bonus and points are given out by the house")
+	ErrInvalidRules             error = errors.New("unknown game rules, leave rules empty to play the target game")
+	ErrInvalidStake             error = errors.New("stake must be a whole number between minStake and maxStake")
+	ErrSessionIDRequired        error = errors.New("please enter the sessionId of the game to end")
+	ErrGameAlreadyEnded         error = errors.New("this game has already ended")
 )
 
 // New Handler
 type PageHandler struct {
-	db *bolt.DB
+	store  store.Store
+	roller dice.Roller
+	//Swapped as a whole on config reload, every request works with the economy it started with
+	economy atomic.Pointer[config.Economy]
 }
 
-// Create and returns new handler, injects boltDB instance
-func NewPageHandler(db *bolt.DB) *PageHandler {
-	return &PageHandler{db}
+// Create and returns new handler, injects storage backend and dice roller, the default economy applies until SetEconomy
+func NewPageHandler(s store.Store, roller dice.Roller) *PageHandler {
+	p := &PageHandler{store: s, roller: roller}
+	p.SetEconomy(config.DefaultEconomy())
+	return p
+}
+
+// SetEconomy replaces prices, payouts and funding rules for every request that starts after it
+func (p *PageHandler) SetEconomy(economy config.Economy) {
+	p.economy.Store(&economy)
+}
+
+// Economy in effect
+func (p *PageHandler) Economy() config.Economy {
+	return *p.economy.Load()
 }
 
 // Register new User
 func (p *PageHandler) Register(rw http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	input, err := readParams(r)
 	if err != nil {
-		http.Error(rw, "unable to parse form", http.StatusInternalServerError)
-	}
-
-	response := model.ApiResponse{
-		Status: false,
+		p.fail(rw, err, nil)
+		return
 	}
-	//TODO: CHECK why ony x-www-enconde functional
 
-	firstName := r.PostFormValue("first_name")
-	lastName := r.PostFormValue("last_name")
+	firstName := input.get("firstName", "first_name")
+	lastName := input.get("lastName", "last_name")
 	if firstName == "" || lastName == "" {
-		response.Message = "Please complete both first and last name"
-		p.JSON(response, rw)
+		p.fail(rw, ErrNameRequired, nil)
 		return
 	}
 
-	userID := util.GenerateUserId(firstName, lastName)
+	userID := util.GenerateId()
 	user := &model.User{
 		FirstName: firstName,
 		LastName:  lastName,
 		UserID:    userID,
 		Wallet:    0,
-		Asset:     "sat",
+		Asset:     string(model.SAT),
+		Role:      model.PLAYER,
 	}
 
-	err = p.db.Update(func(tx *bolt.Tx) error {
-		bucket, err := tx.CreateBucketIfNotExists([]byte(UserBucket))
+	//Username and password are optional, players who pick them can log in from any device
+	var credential *model.Credential
+	username := normalizeUsername(input.get("username"))
+	password := input.get("password")
+	if username != "" || password != "" {
+		credential, err = newCredential(userID, username, password)
 		if err != nil {
-			log.Printf("database error - %s", err)
-			return fmt.Errorf("error unable to encode struct")
+			p.fail(rw, err, nil)
+			return
 		}
-		userByte := util.EncodeStruct(user)
-		if userByte == nil {
-			return fmt.Errorf("error unable to encode struct")
+		user.Username = credential.Username
+	}
+
+	var apiKey string
+	err = p.store.Update(func(tx store.Tx) error {
+		//Never overwrite an existing user
+		if _, err := tx.GetUser(userID); err == nil {
+			return store.ErrAlreadyExists
 		}
-		return bucket.Put([]byte(userID), userByte)
+		if credential != nil {
+			if _, err := tx.GetCredential(credential.Username); err == nil {
+				return ErrUsernameTaken
+			}
+		}
+		if err := tx.PutUser(user); err != nil {
+			return err
+		}
+		if credential != nil {
+			if err := tx.PutCredential(credential); err != nil {
+				return err
+			}
+		}
+		//The player authenticates every other request with this key
+		var err error
+		apiKey, err = issueApiKey(tx, userID)
+		return err
 	})
 
 	if err != nil {
+		if err == ErrUsernameTaken {
+			p.fail(rw, err, nil)
+			return
+		}
 		log.Printf("%s", err)
-		response.Message = "Something went wrong, unable to create new user"
-		p.JSON(response, rw)
+		p.fail(rw, ErrUnableToRegister, nil)
+		return
 	}
 
-	response.Status = true
-	response.Message = "New user created, you can now start games"
-	response.Data = user
-
-	p.JSON(response, rw)
+	p.success(rw, "New user created, keep your API key safe, it will not be shown again", model.Registration{User: *user, ApiKey: apiKey})
 	return
 }
 
 // Start New Game
 func (p *PageHandler) StartGame(rw http.ResponseWriter, r *http.Request) {
-	_ = r.ParseForm()
-
-	response := model.ApiResponse{
-		Status: false,
-	}
-	userID := r.PostFormValue("userId")
-
-	if userID == "" {
-		response.Message = "Please enter User ID"
-		p.JSON(response, rw)
-	}
-
-	//Validate user
-	user, err := p.getUser(userID)
+	input, err := readParams(r)
 	if err != nil {
-		log.Println(err)
-		response.Message = err.Error()
-		p.JSON(response, rw)
+		p.fail(rw, err, nil)
 		return
 	}
+	userID := UserID(r)
+	economy := p.Economy()
 
-	//Check if user has funds to start new game
-	if user.Wallet < 20 {
-		response.Message = "You do not have enough funds to start the game, please fund your account"
-		p.JSON(response, rw)
-		return
-	}
+	//Player can pick their own client seed, otherwise one is generated for them
+	clientSeed := input.get("clientSeed")
 
-	//Check if there is a game in session
-	_, err = p.getActiveGame(userID)
-	//if there is an active game, err will be nil
-	//return with error (There is an active game)
-	if err == nil {
-		response.Message = ErrGameInSession.Error()
-		p.JSON(response, rw)
+	//Rule set the game is played by, every round of the game uses it
+	rulesName := input.get("rules")
+	if rulesName == "" {
+		rulesName = game.DefaultRules
+	}
+	rules, err := game.Lookup(rulesName)
+	if err != nil {
+		p.fail(rw, ErrInvalidRules, nil)
 		return
 	}
 
-	//create new game session
-	session := model.GameSession{
-		SessionID:  util.GenerateId(),
-		UserId:     userID,
-		GameStatus: model.INPROGRESS,
-	}
-	//Create transaction for new game session
-	transaction := model.Transaction{
-		Type:        model.DEBIT,
-		Time:        time.Now().Unix(),
-		Description: "Started new Game",
-		Amount:      GameStartCost,
-		UserID:      userID,
-	}
-	//Substract new game amount from wallet balance
-	user.Wallet -= transaction.Amount
-
-	err = p.db.Update(func(tx *bolt.Tx) error {
-		//Get user bucket from bolt db
-		userBucket := tx.Bucket([]byte(UserBucket))
-		if userBucket == nil {
-			log.Printf("database error - %s", err)
-			return ErrUserNotExist
-		}
-		//Get transaction bucket from bolt db
-		transactionBucket, err := tx.CreateBucketIfNotExists([]byte(TransactionBucket))
+	var session model.GameSession
+	/*
+		. Validate user and check balance against the current state
+		. Check if there is a game in session
+		. Debit wallet, insert transaction and game session
+		All within a single write transaction so concurrent requests cannot both pass the checks
+	*/
+	err = p.store.Update(func(tx store.Tx) error {
+		user, err := getActiveUser(tx, userID)
 		if err != nil {
-			log.Printf("error unable to create transactions bucket - %s", err)
-			return ErrUnableToStartGame
+			return err
 		}
-		//Get game session bucket from bolt db
-		gameSessionBucket, err := tx.CreateBucketIfNotExists([]byte(GameSessionBucket))
+
+		//Check if user has funds to start new game, bonus credit counts
+		spendable, err := spendableBalance(tx, user, GameStartAsset)
 		if err != nil {
-			log.Printf("error unable to create game session bucket - %s", err)
+			log.Printf("error reading balance - %s", err)
 			return ErrUnableToStartGame
 		}
+		if spendable < economy.GameStartCost {
+			return ErrInsufficientFundsToStart
+		}
 
-		/*
-			. Crete new sequence for transaction
-			. Encode Data (transaction, user, gameSession)
-			. Update/Insert data into respective buckets
-		*/
-		id, _ := transactionBucket.NextSequence()
-		transactionByte := util.EncodeStruct(transaction)
-		if transactionByte == nil {
-			log.Println("error encoding transaction struct")
-			return ErrUnableToFundWallet
+		//Check if there is a game in session
+		//if there is an active game, err will be nil
+		//return with error (There is an active game)
+		if _, err := tx.GetActiveGame(userID); err == nil {
+			return ErrGameInSession
 		}
 
-		gameSessionByte := util.EncodeStruct(session)
-		if gameSessionByte == nil {
-			log.Println("error encoding transaction struct")
-			return ErrUnableToFundWallet
+		//Commit to a server seed, only its hash is shown until the game ends
+		serverSeed, err := dice.NewSeed(p.roller, dice.SeedSize)
+		if err != nil {
+			log.Printf("error generating server seed - %s", err)
+			return ErrUnableToStartGame
 		}
-		userByte := util.EncodeStruct(user)
-		if userByte == nil {
-			log.Println("error encoding user struct")
-			return ErrUnableToFundWallet
+		if clientSeed == "" {
+			clientSeed, err = dice.NewSeed(p.roller, dice.SeedSize/2)
+			if err != nil {
+				log.Printf("error generating client seed - %s", err)
+				return ErrUnableToStartGame
+			}
 		}
 
-		if err := transactionBucket.Put(util.Itob(int(id)), transactionByte); err != nil {
-			log.Println("error inserting transaction")
+		//create new game session
+		session = model.GameSession{
+			SessionID:      util.GenerateId(),
+			UserId:         userID,
+			GameStatus:     model.INPROGRESS,
+			ServerSeedHash: dice.HashSeed(serverSeed),
+			ServerSeed:     serverSeed,
+			ClientSeed:     clientSeed,
+			Rules:          rules.Name(),
+			StartedAt:      time.Now().Unix(),
+			Staked:         economy.GameStartCost,
+			Totalled:       true,
+		}
+		if _, err := tx.GetGameSession(session.SessionID); err == nil {
+			log.Printf("game session %s already exists", session.SessionID)
 			return ErrUnableToStartGame
 		}
-		if err := userBucket.Put([]byte(userID), userByte); err != nil {
-			log.Println("error updating user")
+		//Create transaction for new game session
+		//Move the cost of the game from the wallet to the house
+		if err := chargeWallet(tx, user, HouseAccount, model.Transaction{
+			Type:        model.DEBIT,
+			Reason:      model.GAME_START,
+			Asset:       GameStartAsset,
+			Description: "Started new Game",
+			Amount:      economy.GameStartCost,
+			SessionID:   session.SessionID,
+		}); err != nil {
+			log.Printf("error posting game start - %s", err)
 			return ErrUnableToStartGame
 		}
-		if err := gameSessionBucket.Put([]byte(session.SessionID), gameSessionByte); err != nil {
-			log.Println("error inserting session")
+		if err := tx.PutGameSession(&session); err != nil {
+			log.Printf("error inserting session - %s", err)
 			return ErrUnableToStartGame
 		}
 		return nil
 	})
 
 	if err != nil {
-		response.Message = err.Error()
-		p.JSON(response, rw)
+		p.fail(rw, err, nil)
 		return
 	}
 
-	response.Status = true
-	response.Message = "Congrats your game session started, you can now roll"
-	response.Data = session
-
-	p.JSON(response, rw)
+	p.success(rw, "Congrats your game session started, you can now roll", session.Public())
 	return
 }
 
 // ROLL Dice
 func (p *PageHandler) Roll(rw http.ResponseWriter, r *http.Request) {
-	_ = r.ParseForm()
-
-	response := model.ApiResponse{
-		Status: false,
-	}
-	userID := r.PostFormValue("userId")
-
-	if userID == "" {
-		response.Message = "Please enter User ID"
-		p.JSON(response, rw)
-	}
-	//Validate user id
-	user, err := p.getUser(userID)
+	input, err := readParams(r)
 	if err != nil {
-		log.Println(err)
-		response.Message = err.Error()
-		p.JSON(response, rw)
-		return
-	}
-	//Check for active game session
-	activeGameSession, err := p.getActiveGame(userID)
-	if err != nil {
-		response.Message = ErrNoGameInSession.Error()
-		p.JSON(response, rw)
+		p.fail(rw, err, nil)
 		return
 	}
+	userID := UserID(r)
+	economy := p.Economy()
 
-	var activeRollSession model.RollSession
-	//Check for an active dice roll
-	err = p.db.View(func(tx *bolt.Tx) error {
-		rollBucket := tx.Bucket([]byte(RollSessionBucket))
-		if rollBucket == nil {
-			log.Println("error unable to find roll bucket")
-			return ErrNoActiveRollSession
-		}
-		c := rollBucket.Cursor()
-
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			var rollSession model.RollSession
-			if err := util.DecodeStruct(v, &rollSession); err != nil {
-				log.Printf("unable to parse session - %s", err)
-				continue
-			}
-			if rollSession.GameSessionID == activeGameSession.SessionID && rollSession.RowStatus == model.INPROGRESS {
-				activeRollSession = rollSession
-				return nil
-			}
+	var (
+		rollSession model.RollSession
+		rules       game.Rules
+		outcome     game.Outcome
+		payout      int
+		wallet      *model.Wallet
+	)
+	/*
+		. Validate user id and check for an active game session
+		. Check for an active dice roll
+		. If there is none, let the rules of the game start a round and quote its payout from the first roll
+		. Otherwise debit the stake the quote was made for, unless it was already taken, and apply the roll to the round
+		. Once the rules decide the round, settle it and credit any winnings
+		Everything is read and written inside one write transaction
+	*/
+	err = p.store.Update(func(tx store.Tx) error {
+		user, err := getActiveUser(tx, userID)
+		if err != nil {
+			return err
 		}
-		return ErrNoActiveRollSession
-	})
-
-	//If there is an err, that means there is no active roll session
-	//So roll first dice
-	if err != nil && err == ErrNoActiveRollSession {
-		//Check if wallet balance is enough to row first dice
-		if user.Wallet < FirstRowCost {
-			response.Message = "You do not have enough funds to roll dice, please fund your account"
-			p.JSON(response, rw)
-			return
+		//Check for active game session
+		activeGameSession, err := tx.GetActiveGame(userID)
+		if err != nil {
+			return ErrNoGameInSession
 		}
-
-		//Structuring Data models
-		newRoll := model.RollSession{
-			GameSessionID: activeGameSession.SessionID,
-			WinningGame:   util.GenerateDiceSessionRoll(),
-			FirstRoll:     util.GenerateDiceRoll(),
-			RowStatus:     model.INPROGRESS,
-			UserID:        userID,
-			RollID:        util.GenerateId(),
+		rules, err = game.Lookup(activeGameSession.Rules)
+		if err != nil {
+			log.Printf("error loading rules of game %s - %s", activeGameSession.SessionID, err)
+			return ErrUnableToRollDice
 		}
 
-		transaction := model.Transaction{
-			Type:        model.DEBIT,
-			Time:        time.Now().Unix(),
-			Description: "Rolled dice",
-			Amount:      FirstRowCost,
-			UserID:      userID,
-		}
-
-		user.Wallet -= transaction.Amount
-
-		/*
-			. Get Respective Buckets (User, Transaction, Dice Roll)
-			. Encode data
-			. Update/Insert data into respective buckets
-		*/
-		err = p.db.Update(func(tx *bolt.Tx) error {
-			userBucket := tx.Bucket([]byte(UserBucket))
-			if userBucket == nil {
-				log.Printf("database error - %s", err)
-				return ErrUnableToRollDice
-			}
+		//Check for an active dice roll
+		activeRollSession, err := tx.GetActiveRoll(activeGameSession.SessionID)
 
-			transactionBucket, err := tx.CreateBucketIfNotExists([]byte(TransactionBucket))
+		//If there is an err, that means there is no active roll session
+		//So start a new round
+		if err == store.ErrNotFound {
+			//Only the roll that starts a round stakes, later rolls ignore the stake sent
+			stake, err := readStake(input, economy)
 			if err != nil {
-				log.Printf("error unable to create transactions bucket - %s", err)
-				return ErrUnableToRollDice
+				return err
 			}
-
-			rollSessionBucket, err := tx.CreateBucketIfNotExists([]byte(RollSessionBucket))
+			//Check if wallet balance is enough to row first dice, bonus credit counts
+			spendable, err := spendableBalance(tx, user, FirstRowAsset)
 			if err != nil {
-				log.Printf("error unable to create roll session bucket - %s", err)
+				log.Printf("error reading balance - %s", err)
 				return ErrUnableToRollDice
 			}
-
-			id, _ := transactionBucket.NextSequence()
-			transactionByte := util.EncodeStruct(transaction)
-			if transactionByte == nil {
-				log.Println("error encoding transaction struct")
-				return ErrUnableToRollDice
+			if spendable < stake {
+				return ErrInsufficientFundsToRoll
 			}
 
-			gameSessionByte := util.EncodeStruct(newRoll)
-			if gameSessionByte == nil {
-				log.Println("error encoding transaction struct")
-				return ErrUnableToRollDice
+			//Each round of the game uses the next nonce
+			nonce := activeGameSession.Nonce
+			rollSession = model.RollSession{
+				GameSessionID: activeGameSession.SessionID,
+				RowStatus:     model.INPROGRESS,
+				UserID:        userID,
+				RollID:        util.GenerateId(),
+				Nonce:         nonce,
+				Stake:         stake,
+				StartedAt:     time.Now().Unix(),
 			}
-			userByte := util.EncodeStruct(user)
-			if userByte == nil {
-				log.Println("error encoding user struct")
+			if err := rules.StartRound(&rollSession, p.roundRoller(activeGameSession, nonce)); err != nil {
+				log.Printf("error rolling dice - %s", err)
 				return ErrUnableToRollDice
 			}
-
-			if err := transactionBucket.Put(util.Itob(int(id)), transactionByte); err != nil {
-				log.Println("error inserting transaction")
-				return ErrUnableToRollDice
+			activeGameSession.Nonce++
+			activeGameSession.RollCount++
+			//The payout is quoted once the first roll is known and fixed on the round, later changes to the house edge do not touch it.
+			//The stake is taken by the roll that follows the quote, a round the first roll already lost costs nothing
+			rollSession.Payout = rules.Payout(rollSession, economy)
+			if rules.Outcome(rollSession) == game.Pending {
+				rollSession.StakeDue = stake
 			}
-			if err := userBucket.Put([]byte(userID), userByte); err != nil {
-				log.Println("error inserting user")
-				return ErrUnableToRollDice
-			}
-			if err := rollSessionBucket.Put([]byte(newRoll.RollID), gameSessionByte); err != nil {
-				log.Println("error inserting session")
-				return ErrUnableToRollDice
-			}
-			return nil
-		})
-
-		//Handle error
-		if err != nil {
-			response.Message = err.Error()
-			p.JSON(response, rw)
-			return
-		}
-		//Return the number rolled and how many they have to roll to win
-		response.Message = fmt.Sprintf("Congrats, you rolled %d to win you have to to roll %d 🤞", newRoll.FirstRoll, newRoll.WinningGame-newRoll.FirstRoll)
-		response.Status = true
-		p.JSON(response, rw)
-		return
 
-	} else {
-		//If there is an active Roll
-		//Generate random dice roll for second roll
-		//Set the active Dice Roll as completed
-		rollNewDice := util.GenerateDiceRoll()
-		activeRollSession.SecondRoll = rollNewDice
-		activeRollSession.RowStatus = model.COMPLETED
-		/*
-			. Get data respective bucket
-			. Encode dice roll
-			. Update active dice roll
-		*/
-		err := p.db.Update(func(tx *bolt.Tx) error {
-			rollSessionBucket := tx.Bucket([]byte(RollSessionBucket))
-			if rollSessionBucket == nil {
-				log.Printf("error unable to create roll session bucket - %s", err)
-				return ErrUnableToStartGame
-			}
-			gameSessionByte := util.EncodeStruct(activeRollSession)
-			if gameSessionByte == nil {
-				log.Println("error encoding dice roll struct")
+			if _, err := tx.GetRollSession(rollSession.RollID); err == nil {
+				log.Printf("roll session %s already exists", rollSession.RollID)
 				return ErrUnableToRollDice
 			}
-
-			if err := rollSessionBucket.Put([]byte(activeRollSession.RollID), gameSessionByte); err != nil {
-				log.Println("error inserting session")
+			if err := tx.PutGameSession(activeGameSession); err != nil {
+				log.Printf("error updating game session - %s", err)
 				return ErrUnableToRollDice
 			}
-			return nil
-		})
-
-		//Handle Error
-		if err != nil {
-			response.Message = err.Error()
-			p.JSON(response, rw)
-			return
-		}
-
-		//Check for winnings
-		if (activeRollSession.FirstRoll + activeRollSession.SecondRoll) == activeRollSession.WinningGame {
-			/*
-				. If user won dice roll
-				. Create transaction data for wallet credit
-				. Update user Wallet
-			*/
-			transaction := model.Transaction{
-				Type:        model.CREDIT,
-				Time:        time.Now().Unix(),
-				Description: "Winnings",
-				Amount:      WinningAmount,
-				UserID:      userID,
-			}
-
-			user.Wallet += transaction.Amount
-
-			err = p.db.Update(func(tx *bolt.Tx) error {
-				userBucket := tx.Bucket([]byte(UserBucket))
-				if userBucket == nil {
-					log.Printf("database error - %s", err)
-					return ErrUnableToRollDice
-				}
-
-				transactionBucket, err := tx.CreateBucketIfNotExists([]byte(TransactionBucket))
+		} else if err != nil {
+			log.Printf("error getting active roll - %s", err)
+			return ErrUnableToRollDice
+		} else {
+			//If there is an active Roll, the next roll goes to it
+			rollSession = *activeRollSession
+			//The roll after the quote takes the stake, rounds that took it when they started have none due
+			if rollSession.StakeDue > 0 {
+				spendable, err := spendableBalance(tx, user, FirstRowAsset)
 				if err != nil {
-					log.Printf("error unable to create transactions bucket - %s", err)
+					log.Printf("error reading balance - %s", err)
 					return ErrUnableToRollDice
 				}
-
-				id, _ := transactionBucket.NextSequence()
-				transactionByte := util.EncodeStruct(transaction)
-				if transactionByte == nil {
-					log.Println("error encoding transaction struct")
-					return ErrUnableToRollDice
-				}
-
-				userByte := util.EncodeStruct(user)
-				if userByte == nil {
-					log.Println("error encoding user struct")
-					return ErrUnableToRollDice
+				if spendable < rollSession.StakeDue {
+					return ErrInsufficientFundsToRoll
 				}
-
-				if err := transactionBucket.Put(util.Itob(int(id)), transactionByte); err != nil {
-					log.Println("error inserting transaction")
+				if err := chargeWallet(tx, user, HouseAccount, model.Transaction{
+					Type:        model.DEBIT,
+					Reason:      model.ROLL_STAKE,
+					Asset:       FirstRowAsset,
+					Description: "Rolled dice",
+					Amount:      rollSession.StakeDue,
+					SessionID:   rollSession.GameSessionID,
+					RollID:      rollSession.RollID,
+				}); err != nil {
+					log.Printf("error posting roll stake - %s", err)
 					return ErrUnableToRollDice
 				}
-				if err := userBucket.Put([]byte(userID), userByte); err != nil {
-					log.Println("error inserting user")
+				activeGameSession.Staked += rollSession.StakeDue
+				rollSession.StakeDue = 0
+				if err := tx.PutGameSession(activeGameSession); err != nil {
+					log.Printf("error updating game session - %s", err)
 					return ErrUnableToRollDice
 				}
-				return nil
-			})
+			}
+			if err := rules.ApplyRoll(&rollSession, p.roundRoller(activeGameSession, rollSession.Nonce)); err != nil {
+				log.Printf("error rolling dice - %s", err)
+				return ErrUnableToRollDice
+			}
+		}
 
-			if err != nil {
-				response.Message = err.Error()
-				p.JSON(response, rw)
-				return
+		//Settle the round once the rules have decided it
+		outcome = rules.Outcome(rollSession)
+		if outcome != game.Pending {
+			rollSession.RowStatus = model.COMPLETED
+			rollSession.EndedAt = time.Now().Unix()
+		}
+		if outcome == game.Won {
+			payout = rollSession.Payout
+			//Rounds started before stakes pay the fixed winning amount
+			if rollSession.Stake == 0 {
+				payout = economy.WinningAmount
+			}
+			//The house pays out the winnings
+			if err := postWallet(tx, user, HouseAccount, &model.Transaction{
+				Type:        model.CREDIT,
+				Reason:      model.WIN_PAYOUT,
+				Asset:       WinningAsset,
+				Description: "Winnings",
+				Amount:      payout,
+				SessionID:   rollSession.GameSessionID,
+				RollID:      rollSession.RollID,
+			}); err != nil {
+				log.Printf("error posting winnings - %s", err)
+				return ErrUnableToRollDice
 			}
+			activeGameSession.Wins++
+			activeGameSession.Won += payout
+			if err := tx.PutGameSession(activeGameSession); err != nil {
+				log.Printf("error updating game session - %s", err)
+				return ErrUnableToRollDice
+			}
+		}
 
-			response.Status = true
-			response.Message = fmt.Sprintf("Hurray 🤑, you have won %d, do you want to try again ", WinningAmount)
-			p.JSON(response, rw)
-			return
+		if err := tx.PutRollSession(&rollSession); err != nil {
+			log.Printf("error inserting session - %s", err)
+			return ErrUnableToRollDice
+		}
 
-		} else {
-			//User did not win, reply with message
-			response.Status = true
-			response.Message = fmt.Sprintf("Oops 😥, you did not win you rolled %d, but you can try again ", activeRollSession.SecondRoll)
-			p.JSON(response, rw)
-			return
+		//Balances after the stake and any winnings
+		wallet, err = userWallet(tx, user, "")
+		if err != nil {
+			log.Printf("error reading balance - %s", err)
+			return ErrUnableToRollDice
 		}
+		return nil
+	})
 
+	if err == ErrInvalidStake {
+		p.fail(rw, err, map[string]int{"minStake": economy.MinStake, "maxStake": economy.MaxStake})
+		return
+	}
+	if err != nil {
+		p.fail(rw, err, nil)
+		return
 	}
 
+	//The rules show the dice, the money is the same for every game
+	result := rules.Result(rollSession)
+	result.RollID = rollSession.RollID
+	result.GameSessionID = rollSession.GameSessionID
+	result.Won = outcome == game.Won
+	result.Payout = payout
+	result.WalletBalance = wallet.Wallet
+	result.Balances = wallet.Balances
+	//A round waiting for its next roll shows the odds and what it would pay
+	if outcome == game.Pending {
+		odds := game.Odds(rules, rollSession, economy)
+		//The quote stored on the round is what it pays, a round the next roll cannot win pays nothing
+		if odds.Probability > 0 {
+			odds.PotentialPayout = rollSession.Payout
+		}
+		result.Odds = &odds
+	}
+	p.success(rw, rules.Message(rollSession, result.Payout), result)
+	return
 }
 
+// End the game sessionId and answer with its settlement, the unversioned route still ends every game when no sessionId is sent
 func (p *PageHandler) EndGame(rw http.ResponseWriter, r *http.Request) {
-	_ = r.ParseForm()
-
-	response := model.ApiResponse{
-		Status: false,
-	}
-	userID := r.PostFormValue("userId")
-
-	if userID == "" {
-		response.Message = "Please enter User ID"
-		p.JSON(response, rw)
-	}
-	//Validate user account
-	_, err := p.getUser(userID)
+	input, err := readParams(r)
 	if err != nil {
-		log.Println(err)
-		response.Message = err.Error()
-		p.JSON(response, rw)
+		p.fail(rw, err, nil)
 		return
 	}
-
-	/*
-		. Check for inprogress games
-		. Update as completed
-		. Check for inprogress dice roll
-		. Update as completed
-	*/
-	err = p.db.Update(func(tx *bolt.Tx) error {
-		gameSessionBucket := tx.Bucket([]byte(GameSessionBucket))
-		if gameSessionBucket == nil {
-			log.Println("unable to get session Bucket")
-			return ErrUnableToEndGame
+	userID := UserID(r)
+	sessionID := input.get("sessionId")
+	if sessionID == "" {
+		if !isLegacy(r) {
+			p.fail(rw, ErrSessionIDRequired, nil)
+			return
 		}
+		p.endAllGames(rw, userID)
+		return
+	}
 
-		rollGameBucket := tx.Bucket([]byte(RollSessionBucket))
-		if rollGameBucket == nil {
-			log.Println("unable to get session Bucket")
-			return ErrUnableToEndGame
+	var settlement model.GameSettlement
+	err = p.store.Update(func(tx store.Tx) error {
+		if _, err := getUser(tx, userID); err != nil {
+			return err
 		}
-
-		gameCursor := gameSessionBucket.Cursor()
-		for k, v := gameCursor.First(); k != nil; k, v = gameCursor.Next() {
-			var gameSession model.GameSession
-			err := util.DecodeStruct(v, &gameSession)
-			if err != nil {
-				log.Println("unable to decode struct")
-				return ErrUnableToEndGame
-			}
-			if gameSession.UserId == userID && gameSession.GameStatus == model.INPROGRESS {
-				gameSession.GameStatus = model.COMPLETED
-				gameSessionByte := util.EncodeStruct(gameSession)
-				err := gameSessionBucket.Put([]byte(gameSession.SessionID), gameSessionByte)
-				if err != nil {
-					log.Println("unable to update game session struct")
-					return ErrUnableToEndGame
-				}
-			}
+		//Games of other players are reported as missing
+		gameSession, err := tx.GetGameSession(sessionID)
+		if err != nil || gameSession.UserId != userID {
+			return ErrGameNotExist
+		}
+		if gameSession.GameStatus != model.INPROGRESS {
+			return ErrGameAlreadyEnded
+		}
+		if err := endGame(tx, gameSession); err != nil {
+			return err
 		}
 
-		rollCursor := rollGameBucket.Cursor()
-		for k, v := rollCursor.First(); k != nil; k, v = rollCursor.Next() {
-			var rollSession model.RollSession
-			err := util.DecodeStruct(v, &rollSession)
-			if err != nil {
-				log.Println("unable to decode struct")
-				return ErrUnableToEndGame
-			}
-			if rollSession.UserID == userID && rollSession.RowStatus == model.INPROGRESS {
-				rollSession.RowStatus = model.COMPLETED
-				rollSessionByte := util.EncodeStruct(rollSession)
-				err := gameSessionBucket.Put([]byte(rollSession.RollID), rollSessionByte)
-				if err != nil {
-					log.Println("unable to update roll session struct")
-					return ErrUnableToEndGame
-				}
-			}
+		//The totals are kept on the game, settling it reads none of the transactions of the player
+		settlement.GameSummary = gameSummary(*gameSession)
+		if gameSession.StartedAt != 0 {
+			settlement.Duration = gameSession.EndedAt - gameSession.StartedAt
 		}
 		return nil
 	})
 
-	//Handle Error
 	if err != nil {
-		log.Println(err)
-		response.Message = err.Error()
-		p.JSON(response, rw)
+		p.fail(rw, err, nil)
 		return
 	}
 
-	response.Status = true
-	response.Message = "Successfully ended all game, we hope to see you again"
-	p.JSON(response, rw)
+	//The settlement reveals the server seed so the rolls of the game can be verified
+	p.success(rw, "Successfully ended your game, we hope to see you again", settlement)
 	return
 }
 
-func (p *PageHandler) CheckActiveGame(rw http.ResponseWriter, r *http.Request) {
-
-	_ = r.ParseForm()
-
-	response := model.ApiResponse{
-		Status: false,
-	}
-	userID := r.URL.Query().Get("userId")
+// End every game of the player, the unversioned end-game without a sessionId
+func (p *PageHandler) endAllGames(rw http.ResponseWriter, userID string) {
+	var endedGames []model.GameSession
+	err := p.store.Update(func(tx store.Tx) error {
+		if _, err := getUser(tx, userID); err != nil {
+			return err
+		}
+		var err error
+		endedGames, err = endGames(tx, userID)
+		return err
+	})
 
-	if userID == "" {
-		response.Message = "Please enter User ID"
-		p.JSON(response, rw)
-	}
-	//Validate user
-	_, err := p.getUser(userID)
 	if err != nil {
-		log.Println(err)
-		response.Message = err.Error()
-		p.JSON(response, rw)
+		p.fail(rw, err, nil)
 		return
 	}
-	//Check for active Game
-	activeGameSession, err := p.getActiveGame(userID)
-	//Handle error
+
+	//Ended games reveal their server seeds so past rolls can be verified
+	p.success(rw, "Successfully ended all game, we hope to see you again", endedGames)
+	return
+}
+
+func (p *PageHandler) CheckActiveGame(rw http.ResponseWriter, r *http.Request) {
+	userID := UserID(r)
+
+	var activeGameSession *model.GameSession
+	err := p.store.View(func(tx store.Tx) error {
+		//Validate user
+		if _, err := getUser(tx, userID); err != nil {
+			return err
+		}
+		//Check for active Game
+		var err error
+		activeGameSession, err = tx.GetActiveGame(userID)
+		if err != nil {
+			return ErrNoGameInSession
+		}
+		return nil
+	})
 	if err != nil {
-		response.Message = ErrNoGameInSession.Error()
-		p.JSON(response, rw)
+		p.fail(rw, err, nil)
 		return
 	}
 
-	response.Status = true
-	response.Data = activeGameSession
-	p.JSON(response, rw)
+	p.success(rw, "", activeGameSession.Public())
 	return
 }
 
+// Fund the wallet, only sat can be funded by players
 func (p *PageHandler) FundWallet(rw http.ResponseWriter, r *http.Request) {
-	_ = r.ParseForm()
-
-	response := model.ApiResponse{
-		Status: false,
-	}
-	userID := r.PostFormValue("userId")
-
-	if userID == "" {
-		response.Message = "Please enter User ID"
-		p.JSON(response, rw)
-	}
-	//Validate user
-	user, err := p.getUser(userID)
+	input, err := readParams(r)
 	if err != nil {
-		log.Println(err)
-		response.Message = err.Error()
-		p.JSON(response, rw)
+		p.fail(rw, err, nil)
 		return
 	}
-	//Check if wallet balance is small enough to allow funding
-	if user.Wallet > 35 {
-		response.Message = "Unfortunately you cannot fund your wallet unless its less than 35"
-		response.Data = user
-		p.JSON(response, rw)
+	userID := UserID(r)
+	economy := p.Economy()
+	asset, err := readAsset(input)
+	if err != nil {
+		p.fail(rw, err, nil)
 		return
 	}
-	/*
-		. Create structure for traansaction
-		. Update user wallet
-	*/
-	transaction := model.Transaction{
-		Type:        model.CREDIT,
-		Time:        time.Now().Unix(),
-		Description: "Wallet Funding",
-		Amount:      FundWalletAmount,
-		UserID:      userID,
+	if asset == "" {
+		asset = FundWalletAsset
+	}
+	if asset != FundWalletAsset {
+		p.fail(rw, ErrAssetNotFundable, nil)
+		return
 	}
 
-	user.Wallet += transaction.Amount
-
+	var wallet *model.Wallet
 	/*
-		. Get bucket for respective data
-		. Encode data
-		. Insert/Update data in respective bucket
+		. Validate user and check the current wallet balance
+		. Create structure for transaction
+		. Update user wallet and insert transaction in the same write transaction
 	*/
-	err = p.db.Update(func(tx *bolt.Tx) error {
-		userBucket := tx.Bucket([]byte(UserBucket))
-		if userBucket == nil {
-			log.Printf("database error - %s", err)
-			return ErrUserNotExist
-		}
-
-		transactionBucket, err := tx.CreateBucketIfNotExists([]byte(TransactionBucket))
+	err = p.store.Update(func(tx store.Tx) error {
+		user, err := getActiveUser(tx, userID)
 		if err != nil {
-			log.Printf("error unable to create transactions bucket - %s", err)
-			return ErrUnableToFundWallet
-		}
-
-		id, _ := transactionBucket.NextSequence()
-		transactionByte := util.EncodeStruct(transaction)
-		if transactionByte == nil {
-			log.Println("error encoding transaction struct")
-			return ErrUnableToFundWallet
+			return err
 		}
-		userByte := util.EncodeStruct(user)
-		if userByte == nil {
-			log.Println("error encoding user struct")
-			return ErrUnableToFundWallet
+		//Check if wallet balance is small enough to allow funding
+		if user.Wallet > economy.FundWalletThreshold {
+			wallet, err = userWallet(tx, user, "")
+			if err != nil {
+				log.Printf("error reading balances - %s", err)
+			}
+			return ErrFundingNotAllowed
 		}
 
-		if err := transactionBucket.Put(util.Itob(int(id)), transactionByte); err != nil {
-			log.Println("error inserting transaction")
+		if err := postWallet(tx, user, FundingAccount, &model.Transaction{
+			Type:        model.CREDIT,
+			Reason:      model.FUNDING,
+			Asset:       FundWalletAsset,
+			Description: "Wallet Funding",
+			Amount:      economy.FundWalletAmount,
+		}); err != nil {
+			log.Printf("error posting wallet funding - %s", err)
 			return ErrUnableToFundWallet
 		}
-		if err := userBucket.Put([]byte(userID), userByte); err != nil {
-			log.Println("error inserting transaction")
+		wallet, err = userWallet(tx, user, "")
+		if err != nil {
+			log.Printf("error reading balances - %s", err)
 			return ErrUnableToFundWallet
 		}
 		return nil
 	})
 	//Handle Error
 	if err != nil {
-		response.Message = err.Error()
-		p.JSON(response, rw)
+		if err == ErrFundingNotAllowed {
+			p.fail(rw, err, wallet)
+			return
+		}
+		p.fail(rw, err, nil)
 		return
 	}
 
-	response.Status = true
-	response.Message = "Wallet funding successful"
-	response.Data = user
-
-	p.JSON(response, rw)
+	p.success(rw, "Wallet funding successful", wallet)
 	return
 }
 
+// User details with their balances, asset narrows the balances down to one asset
 func (p *PageHandler) GetWalletBalance(rw http.ResponseWriter, r *http.Request) {
-	_ = r.ParseForm()
-
-	response := model.ApiResponse{
-		Status: false,
+	input, err := readParams(r)
+	if err != nil {
+		p.fail(rw, err, nil)
+		return
 	}
-	userID := r.URL.Query().Get("userId")
-
-	if userID == "" {
-		response.Message = "Please enter User ID"
-		p.JSON(response, rw)
+	userID := UserID(r)
+	asset, err := readAsset(input)
+	if err != nil {
+		p.fail(rw, err, nil)
+		return
 	}
-	//Validate User
-	user, err := p.getUser(userID)
-	//Handle Error
+
+	var wallet *model.Wallet
+	err = p.store.View(func(tx store.Tx) error {
+		//Validate User
+		user, err := getUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		wallet, err = userWallet(tx, user, asset)
+		if err != nil {
+			log.Printf("error reading balances - %s", err)
+		}
+		return err
+	})
 	if err != nil {
-		log.Println(err)
-		response.Message = err.Error()
-		p.JSON(response, rw)
+		p.fail(rw, err, nil)
 		return
 	}
 	//Return user (user detail contains wallet)
-	response.Status = true
-	response.Data = user
-	p.JSON(response, rw)
+	p.success(rw, "", wallet)
 	return
 
 }
 
-func (p *PageHandler) Transactions(rw http.ResponseWriter, r *http.Request) {
-	_ = r.ParseForm()
-
-	response := model.ApiResponse{
-		Status: false,
+// Asset named by the request, empty when none is given
+func readAsset(input params) (model.Asset, error) {
+	asset := model.Asset(strings.ToLower(input.get("asset")))
+	if asset == "" {
+		return "", nil
 	}
-	userID := r.URL.Query().Get("userId")
+	for _, known := range model.Assets {
+		if asset == known {
+			return asset, nil
+		}
+	}
+	return "", ErrInvalidAsset
+}
 
-	if userID == "" {
-		response.Message = "Please enter User ID"
-		p.JSON(response, rw)
+// Read the stake of a round, the configured default applies when none is sent
+func readStake(input params, economy config.Economy) (int, error) {
+	value := input.get("stake")
+	if value == "" {
+		return economy.FirstRollCost, nil
 	}
-	//Validate user details
-	_, err := p.getUser(userID)
-	if err != nil {
-		log.Println(err)
-		response.Message = err.Error()
-		p.JSON(response, rw)
+	stake, err := strconv.Atoi(value)
+	if err != nil || stake < economy.MinStake || stake > economy.MaxStake {
+		return 0, ErrInvalidStake
+	}
+	return stake, nil
+}
+
+// Transactions of the player, newest first in pages under /v1, the unversioned route still returns all of them oldest first
+func (p *PageHandler) Transactions(rw http.ResponseWriter, r *http.Request) {
+	userID := UserID(r)
+	if !isLegacy(r) {
+		p.pagedTransactions(rw, r, userID)
 		return
 	}
 
 	transactions := make([]model.Transaction, 0)
-	/*
-		. Get transaction bucket
-		. Go through each of them
-		. append into transactions slice
-	*/
-	err = p.db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(TransactionBucket))
-		if bucket == nil {
-			log.Printf("error no transactions table - %s", err)
-			return ErrNoTransactionsAvailable
+	err := p.store.View(func(tx store.Tx) error {
+		//Validate user details
+		if _, err := getUser(tx, userID); err != nil {
+			return err
 		}
 
-		c := bucket.Cursor()
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			var transaction model.Transaction
-			err := util.DecodeStruct(v, &transaction)
-			if err != nil {
-				log.Printf("error decoding byte to struct %s", err)
-				continue
-			}
-			if transaction.UserID == userID {
-				transactions = append(transactions, transaction)
-			}
+		var err error
+		transactions, err = tx.ListTransactions(userID)
+		if err != nil {
+			log.Printf("error listing transactions - %s", err)
+			return ErrNoTransactionsAvailable
 		}
 		return nil
 	})
 
 	//Handle error
 	if err != nil {
-		response.Message = err.Error()
-		response.Data = transactions
-		p.JSON(response, rw)
+		p.fail(rw, err, transactions)
 		return
 	}
 
-	response.Status = true
-	response.Data = transactions
-	p.JSON(response, rw)
+	p.success(rw, "", transactions)
 	return
 }
 
-func (p *PageHandler) getActiveGame(userID string) (*model.GameSession, error) {
-	var activeSession model.GameSession
+// Recompute a roll from its seeds.
+// Takes either the ID of a roll in a completed game, or serverSeed, clientSeed and nonce to check any roll by hand
+func (p *PageHandler) VerifyRoll(rw http.ResponseWriter, r *http.Request) {
+	input, err := readParams(r)
+	if err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+	rollID := input.get("rollId")
 
-	err := p.db.View(func(tx *bolt.Tx) error {
-		gameSessionBucket := tx.Bucket([]byte(GameSessionBucket))
-		if gameSessionBucket == nil {
-			log.Println("error unable to get game session bucket")
-			return errors.New("unable to get game bucket")
-		}
+	verification := model.RollVerification{
+		ServerSeed: input.get("serverSeed"),
+		ClientSeed: input.get("clientSeed"),
+	}
+	var roll *model.RollSession
 
-		c := gameSessionBucket.Cursor()
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			err := util.DecodeStruct(v, &activeSession)
+	if rollID != "" {
+		err = p.store.View(func(tx store.Tx) error {
+			var err error
+			roll, err = tx.GetRollSession(rollID)
+			if err != nil {
+				return ErrRollNotExist
+			}
+			gameSession, err := tx.GetGameSession(roll.GameSessionID)
 			if err != nil {
-				log.Printf("error unable to parse game session - %s", err)
-				continue
+				return ErrRollNotExist
 			}
-			if activeSession.UserId == userID && activeSession.GameStatus == model.INPROGRESS {
-				return nil
+			if gameSession.ServerSeedHash == "" {
+				return ErrRollNotVerifiable
 			}
+			if gameSession.GameStatus != model.COMPLETED {
+				return ErrSeedNotRevealed
+			}
+			verification.RollID = roll.RollID
+			verification.ServerSeed = gameSession.ServerSeed
+			verification.ServerSeedHash = gameSession.ServerSeedHash
+			verification.ClientSeed = gameSession.ClientSeed
+			verification.Nonce = roll.Nonce
+			return nil
+		})
+		if err != nil {
+			p.fail(rw, err, nil)
+			return
 		}
-		return ErrNoGameInSession
-	})
+	} else {
+		nonce, err := strconv.Atoi(input.get("nonce"))
+		if err != nil || nonce < 0 || verification.ServerSeed == "" || verification.ClientSeed == "" {
+			p.fail(rw, ErrInvalidVerifyRequest, nil)
+			return
+		}
+		verification.Nonce = nonce
+	}
 
+	outcome, err := dice.Fair(verification.ServerSeed, verification.ClientSeed, verification.Nonce)
 	if err != nil {
-		return nil, err
+		log.Printf("error recomputing roll - %s", err)
+		p.fail(rw, ErrUnableToRollDice, nil)
+		return
+	}
+	verification.WinningGame = outcome.WinningGame
+	verification.FirstRoll = outcome.FirstRoll
+	verification.SecondRoll = outcome.SecondRoll
+
+	if roll != nil {
+		hashMatches := dice.HashSeed(verification.ServerSeed) == verification.ServerSeedHash
+		//A roll that was never finished has no second dice to compare
+		rollMatches := roll.WinningGame == outcome.WinningGame && roll.FirstRoll == outcome.FirstRoll &&
+			(roll.SecondRoll == 0 || roll.SecondRoll == outcome.SecondRoll)
+		verification.HashMatches = &hashMatches
+		verification.RollMatches = &rollMatches
+	} else {
+		verification.ServerSeedHash = dice.HashSeed(verification.ServerSeed)
 	}
 
-	return &activeSession, nil
+	p.success(rw, "", verification)
+	return
+}
 
+// End every game and dice roll of user still in progress, returns the games that were ended
+func endGames(tx store.Tx, userID string) ([]model.GameSession, error) {
+	endedGames := make([]model.GameSession, 0)
+	gameSessions, err := tx.ListGameSessions(userID)
+	if err != nil {
+		log.Printf("unable to list game sessions - %s", err)
+		return nil, ErrUnableToEndGame
+	}
+	for _, gameSession := range gameSessions {
+		inProgress := gameSession.GameStatus == model.INPROGRESS
+		if err := endGame(tx, &gameSession); err != nil {
+			return nil, err
+		}
+		if inProgress {
+			endedGames = append(endedGames, gameSession)
+		}
+	}
+	return endedGames, nil
 }
-func (p *PageHandler) getUser(userID string) (*model.User, error) {
-	var user model.User
-	err := p.db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(UserBucket))
-		if bucket == nil {
-			log.Println("error getting db bucket ")
-			return ErrUserNotExist
-		}
-
-		userByte := bucket.Get([]byte(userID))
-		fmt.Printf("%s\n", userByte)
-		err := util.DecodeStruct(userByte, &user)
-		if err != nil {
-			log.Printf("error parsing struct - %s", err)
-			return ErrUserNotExist
+
+// End one game, its dice rolls still in progress are completed even when the game already was
+func endGame(tx store.Tx, gameSession *model.GameSession) error {
+	/*
+		. Check for inprogress dice roll
+		. Update as completed
+		. Update the game as completed if it is in progress
+	*/
+	now := time.Now().Unix()
+	rollSessions, err := tx.ListRollSessions(gameSession.SessionID)
+	if err != nil {
+		log.Printf("unable to list roll sessions - %s", err)
+		return ErrUnableToEndGame
+	}
+	for _, rollSession := range rollSessions {
+		if rollSession.RowStatus != model.INPROGRESS {
+			continue
+		}
+		//A stake still due is never taken
+		rollSession.RowStatus = model.COMPLETED
+		rollSession.StakeDue = 0
+		rollSession.EndedAt = now
+		if err := tx.PutRollSession(&rollSession); err != nil {
+			log.Println("unable to update roll session struct")
+			return ErrUnableToEndGame
 		}
+	}
+
+	if gameSession.GameStatus != model.INPROGRESS {
 		return nil
-	})
-	if err != nil {
-		return nil, err
 	}
+	gameSession.GameStatus = model.COMPLETED
+	gameSession.EndedAt = now
+	if err := tx.PutGameSession(gameSession); err != nil {
+		log.Println("unable to update game session struct")
+		return ErrUnableToEndGame
+	}
+	return nil
+}
+
+// Roller over the dice of round nonce of game, every call starts again at the first die of the round.
+// Games started before seeds existed fall back to the house roller
+func (p *PageHandler) roundRoller(gameSession *model.GameSession, nonce int) dice.Roller {
+	if gameSession.ServerSeed != "" {
+		return dice.FairRoller(gameSession.ServerSeed, gameSession.ClientSeed, nonce)
+	}
+	return p.roller
+}
 
-	return &user, nil
+// Get user within an open transaction, maps a missing record to ErrUserNotExist
+func getUser(tx store.Tx, userID string) (*model.User, error) {
+	user, err := tx.GetUser(userID)
+	if err != nil {
+		if err != store.ErrNotFound {
+			log.Printf("error getting user - %s", err)
+		}
+		return nil, ErrUserNotExist
+	}
+	return user, nil
 }
 
-func (p *PageHandler) JSON(data any, rw http.ResponseWriter) {
-	rw.Header().Add("Content-Type", "application/json")
-	jsonByte, err := json.Marshal(data)
+// Get user that is allowed to play and move money, frozen accounts are rejected
+func getActiveUser(tx store.Tx, userID string) (*model.User, error) {
+	user, err := getUser(tx, userID)
 	if err != nil {
-		rw.WriteHeader(500)
-		return
+		return nil, err
+	}
+	if user.Frozen {
+		return nil, ErrAccountFrozen
 	}
-	_, err = rw.Write(jsonByte)
+	return user, nil
 }
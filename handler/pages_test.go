@@ -0,0 +1,333 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/promisefemi/apexnetwork-take-home/dice"
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/store"
+)
+
+var errInjected = errors.New("injected failure")
+
+// failingStore hands out write transactions that fail the method named failOn, reads pass straight through
+type failingStore struct {
+	store.Store
+	failOn string
+}
+
+func (s *failingStore) Update(fn func(tx store.Tx) error) error {
+	return s.Store.Update(func(tx store.Tx) error {
+		return fn(&failingTx{Tx: tx, failOn: s.failOn})
+	})
+}
+
+type failingTx struct {
+	store.Tx
+	failOn string
+}
+
+func (t *failingTx) AddTransaction(transaction *model.Transaction) error {
+	if t.failOn == "AddTransaction" {
+		return errInjected
+	}
+	return t.Tx.AddTransaction(transaction)
+}
+
+func (t *failingTx) PutUser(user *model.User) error {
+	if t.failOn == "PutUser" {
+		return errInjected
+	}
+	return t.Tx.PutUser(user)
+}
+
+func (t *failingTx) EachTransaction(userID string, fn func(transaction *model.Transaction) error) error {
+	if t.failOn == "EachTransaction" {
+		return errInjected
+	}
+	return t.Tx.EachTransaction(userID, fn)
+}
+
+func (t *failingTx) PutRollSession(roll *model.RollSession) error {
+	if t.failOn == "PutRollSession" {
+		return errInjected
+	}
+	return t.Tx.PutRollSession(roll)
+}
+
+// Call a handler directly as userID, body is sent as JSON
+func call(handler http.HandlerFunc, userID, body string) (int, model.ApiResponse) {
+	r := httptest.NewRequest(http.MethodPost, "/v1/test", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r = r.WithContext(context.WithValue(r.Context(), userIDContextKey, userID))
+	rw := httptest.NewRecorder()
+	handler(rw, r)
+
+	var response model.ApiResponse
+	_ = json.Unmarshal(rw.Body.Bytes(), &response)
+	return rw.Code, response
+}
+
+// Sat balance of userID as the user record and the ledger see it
+func balances(t *testing.T, s store.Store, userID string) (int, int) {
+	t.Helper()
+	var wallet, ledger int
+	err := s.View(func(tx store.Tx) error {
+		user, err := tx.GetUser(userID)
+		if err != nil {
+			return err
+		}
+		wallet = user.Wallet
+		ledger, err = tx.GetAccountBalance(WalletAccount(userID, model.SAT))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("reading balances - %s", err)
+	}
+	return wallet, ledger
+}
+
+// Put the round of game waiting for its second roll, target 4 and a first die of 2, and roll it.
+// The sequence roller only draws 2, so the second die reaches the target
+func rollToWin(t *testing.T, s *failingStore, p *PageHandler, userID string) (int, model.ApiResponse) {
+	t.Helper()
+	err := s.Store.Update(func(tx store.Tx) error {
+		return tx.PutRollSession(&model.RollSession{RollID: "roll", GameSessionID: "game", UserID: userID, WinningGame: 4, FirstRoll: 2, RowStatus: model.INPROGRESS})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return call(p.Roll, userID, "")
+}
+
+// A failure anywhere in the settling roll leaves the round, the wallet, the transactions and the ledger as they were
+func TestRollSettlementIsAtomic(t *testing.T) {
+	for _, failOn := range []string{"AddTransaction", "PutUser", "PutRollSession"} {
+		t.Run(failOn, func(t *testing.T) {
+			s := &failingStore{Store: store.NewMemoryStore()}
+			p := NewPageHandler(s, dice.NewSequenceRoller(2))
+			userID := "player"
+
+			err := s.Update(func(tx store.Tx) error {
+				if err := tx.PutUser(&model.User{UserID: userID, Asset: string(model.SAT), Role: model.PLAYER}); err != nil {
+					return err
+				}
+				return tx.PutGameSession(&model.GameSession{SessionID: "game", UserId: userID, GameStatus: model.INPROGRESS})
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code, response := call(p.FundWallet, userID, ""); code != http.StatusOK {
+				t.Fatalf("funding wallet - %d %s", code, response.Message)
+			}
+			var entries int
+			_ = s.View(func(tx store.Tx) error {
+				journal, _ := tx.ListJournalEntries(WalletAccount(userID, model.SAT))
+				entries = len(journal)
+				return nil
+			})
+			walletBefore, ledgerBefore := balances(t, s, userID)
+
+			s.failOn = failOn
+			if code, _ := rollToWin(t, s, p, userID); code == http.StatusOK {
+				t.Fatalf("settling roll succeeded with %s failing", failOn)
+			}
+
+			err = s.View(func(tx store.Tx) error {
+				roll, err := tx.GetActiveRoll("game")
+				if err != nil {
+					t.Errorf("round is no longer in progress - %s", err)
+				} else if roll.SecondRoll != 0 {
+					t.Errorf("round has second roll %d, want it untouched", roll.SecondRoll)
+				}
+				transactions, err := tx.ListTransactions(userID)
+				if err != nil {
+					return err
+				}
+				for _, transaction := range transactions {
+					if transaction.Type == model.CREDIT && transaction.Reason == model.WIN_PAYOUT {
+						t.Errorf("winnings transaction %d was written", transaction.ID)
+					}
+				}
+				journal, err := tx.ListJournalEntries(WalletAccount(userID, model.SAT))
+				if err != nil {
+					return err
+				}
+				if len(journal) != entries {
+					t.Errorf("%d journal entries, want %d", len(journal), entries)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wallet, ledger := balances(t, s, userID); wallet != walletBefore || ledger != ledgerBefore {
+				t.Errorf("wallet %d and ledger %d, want %d and %d", wallet, ledger, walletBefore, ledgerBefore)
+			}
+
+			//Once the failure is gone the same round settles and pays out
+			s.failOn = ""
+			code, response := rollToWin(t, s, p, userID)
+			if code != http.StatusOK {
+				t.Fatalf("settling roll - %d %s", code, response.Message)
+			}
+			result, _ := response.Data.(map[string]any)
+			payout, _ := result["payout"].(float64)
+			if won, _ := result["won"].(bool); !won || payout <= 0 {
+				t.Fatalf("settling roll did not win - %v", response.Data)
+			}
+			if throws, _ := result["throws"].([]any); len(throws) != 2 || result["phase"] != string(model.SECOND_ROLL) {
+				t.Errorf("settling roll showed throws %v in phase %v, want both dice in the second phase", result["throws"], result["phase"])
+			}
+			if wallet, ledger := balances(t, s, userID); wallet != walletBefore+int(payout) || ledger != wallet {
+				t.Errorf("wallet %d and ledger %d after winning %d, want %d", wallet, ledger, int(payout), walletBefore+int(payout))
+			}
+		})
+	}
+}
+
+// The stake is read by the roll that starts a round and taken by the roll after the quote,
+// a stake sent with the second roll is ignored even when it is not valid
+func TestStakeTakenAfterQuote(t *testing.T) {
+	s := store.NewMemoryStore()
+	//Target 4 and a first die of 2, the second roll then draws 5, 4 and a 2 which wins
+	p := NewPageHandler(s, dice.NewSequenceRoller(4, 2, 5))
+	userID := "player"
+	err := s.Update(func(tx store.Tx) error {
+		if err := tx.PutUser(&model.User{UserID: userID, Asset: string(model.SAT), Role: model.PLAYER}); err != nil {
+			return err
+		}
+		return tx.PutGameSession(&model.GameSession{SessionID: "game", UserId: userID, GameStatus: model.INPROGRESS})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, response := call(p.FundWallet, userID, ""); code != http.StatusOK {
+		t.Fatalf("funding wallet - %d %s", code, response.Message)
+	}
+	walletBefore, _ := balances(t, s, userID)
+
+	code, response := call(p.Roll, userID, `{"stake": 0}`)
+	if code != http.StatusBadRequest {
+		t.Fatalf("starting a round with stake 0 answered %d, want %d", code, http.StatusBadRequest)
+	}
+	if limits, _ := response.Data.(map[string]any); limits["minStake"] == nil || limits["maxStake"] == nil {
+		t.Errorf("invalid stake answered without the limits - %v", response.Data)
+	}
+
+	code, response = call(p.Roll, userID, `{"stake": 10}`)
+	if code != http.StatusOK {
+		t.Fatalf("first roll - %d %s", code, response.Message)
+	}
+	var result model.RollResult
+	if err := remarshal(response.Data, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Odds == nil || result.Odds.Probability != 1.0/6 || result.Odds.Multiplier != 5.7 || result.Odds.PotentialPayout != 57 {
+		t.Errorf("first roll quoted %+v, want probability 1/6, multiplier 5.7 and payout 57", result.Odds)
+	}
+	if wallet, _ := balances(t, s, userID); wallet != walletBefore {
+		t.Errorf("wallet %d after the quote, want the stake still in it at %d", wallet, walletBefore)
+	}
+
+	code, response = call(p.Roll, userID, `{"stake": "not a stake"}`)
+	if code != http.StatusOK {
+		t.Fatalf("second roll with an invalid stake - %d %s", code, response.Message)
+	}
+	if err := remarshal(response.Data, &result); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Won || result.Payout != 57 {
+		t.Fatalf("second roll won %v paying %d, want the quote of 57", result.Won, result.Payout)
+	}
+	if wallet, ledger := balances(t, s, userID); wallet != walletBefore-10+57 || ledger != wallet {
+		t.Errorf("wallet %d and ledger %d after the round, want %d", wallet, ledger, walletBefore-10+57)
+	}
+}
+
+// A first die that leaves the target out of reach loses the round on that roll without taking the stake
+func TestUnreachableTargetLosesWithoutStake(t *testing.T) {
+	tests := []struct {
+		name          string
+		target, first int
+	}{
+		{"needs 0", 6, 6},
+		{"needs less than 0", 3, 5},
+		{"needs more than 6", 12, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := store.NewMemoryStore()
+			p := NewPageHandler(s, dice.NewSequenceRoller(tt.target, tt.first))
+			userID := "player"
+			err := s.Update(func(tx store.Tx) error {
+				if err := tx.PutUser(&model.User{UserID: userID, Asset: string(model.SAT), Role: model.PLAYER}); err != nil {
+					return err
+				}
+				return tx.PutGameSession(&model.GameSession{SessionID: "game", UserId: userID, GameStatus: model.INPROGRESS})
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code, response := call(p.FundWallet, userID, ""); code != http.StatusOK {
+				t.Fatalf("funding wallet - %d %s", code, response.Message)
+			}
+			walletBefore, _ := balances(t, s, userID)
+
+			code, response := call(p.Roll, userID, `{"stake": 10}`)
+			if code != http.StatusOK {
+				t.Fatalf("first roll - %d %s", code, response.Message)
+			}
+			var result model.RollResult
+			if err := remarshal(response.Data, &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Won || result.Payout != 0 || result.Odds != nil || result.Phase != model.FIRST_ROLL {
+				t.Errorf("roll answered %+v, want a lost first roll without odds", result)
+			}
+			if wallet, ledger := balances(t, s, userID); wallet != walletBefore || ledger != wallet {
+				t.Errorf("wallet %d and ledger %d, want the stake untaken at %d", wallet, ledger, walletBefore)
+			}
+
+			err = s.View(func(tx store.Tx) error {
+				if roll, err := tx.GetActiveRoll("game"); err == nil {
+					t.Errorf("round %s still waits for a second roll", roll.RollID)
+				}
+				roll, err := tx.GetRollSession(result.RollID)
+				if err != nil {
+					return err
+				}
+				if roll.RowStatus != model.COMPLETED || roll.StakeDue != 0 {
+					t.Errorf("round is %s with %d stake due, want it completed with none", roll.RowStatus, roll.StakeDue)
+				}
+				session, err := tx.GetGameSession("game")
+				if err != nil {
+					return err
+				}
+				if session.RollCount != 1 || session.Staked != 0 {
+					t.Errorf("game has %d rounds and %d staked, want 1 round and nothing staked", session.RollCount, session.Staked)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			//The next roll starts a new round
+			code, response = call(p.Roll, userID, `{"stake": 10}`)
+			var next model.RollResult
+			if err := remarshal(response.Data, &next); err != nil || code != http.StatusOK {
+				t.Fatalf("next roll - %d %s", code, response.Message)
+			}
+			if next.RollID == result.RollID {
+				t.Errorf("next roll went to the lost round %s", result.RollID)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/store"
+)
+
+// Reconcile recomputes the sat balance of every user from their CREDIT and DEBIT transactions and reports the wallets that drifted.
+// With correct set every drift gets a correcting transaction so the history adds up to the wallet again, each one
+// recorded in the audit log under actorID with reason. The wallet itself is left alone, it is backed by the ledger
+func (p *PageHandler) Reconcile(actorID, reason string, correct bool) (*model.ReconcileReport, error) {
+	reason = strings.TrimSpace(reason)
+	if correct && reason == "" {
+		return nil, ErrReasonRequired
+	}
+	report := &model.ReconcileReport{
+		Time:       time.Now().Unix(),
+		Mismatches: make([]model.WalletDrift, 0),
+	}
+
+	run := p.store.View
+	if correct {
+		run = p.store.Update
+	}
+	err := run(func(tx store.Tx) error {
+		users, err := tx.ListUsers()
+		if err != nil {
+			return err
+		}
+		report.Users = len(users)
+		for _, user := range users {
+			balance, err := transactionBalance(tx, user.UserID)
+			if err != nil {
+				return err
+			}
+			if balance == user.Wallet {
+				continue
+			}
+
+			drift := model.WalletDrift{
+				UserID:             user.UserID,
+				Wallet:             user.Wallet,
+				TransactionBalance: balance,
+				Drift:              user.Wallet - balance,
+			}
+			if correct {
+				if err := correctDrift(tx, actorID, reason, drift); err != nil {
+					return err
+				}
+				drift.Corrected = true
+			}
+			report.Mismatches = append(report.Mismatches, drift)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// CREDIT minus DEBIT over every sat transaction of user, the wallet only holds sat
+func transactionBalance(tx store.Tx, userID string) (int, error) {
+	transactions, err := tx.ListTransactions(userID)
+	if err != nil {
+		return 0, err
+	}
+	balance := 0
+	for _, transaction := range transactions {
+		if transaction.Asset != model.SAT && transaction.Asset != "" {
+			continue
+		}
+		switch transaction.Type {
+		case model.CREDIT:
+			balance += transaction.Amount
+		case model.DEBIT:
+			balance -= transaction.Amount
+		}
+	}
+	return balance, nil
+}
+
+// Write the transaction that makes the history of a user add up to their wallet, and audit it
+func correctDrift(tx store.Tx, actorID, reason string, drift model.WalletDrift) error {
+	transactionType, amount := model.CREDIT, drift.Drift
+	if amount < 0 {
+		transactionType, amount = model.DEBIT, -amount
+	}
+	now := time.Now()
+	wallet := drift.Wallet
+	err := tx.AddTransaction(&model.Transaction{
+		Type:         transactionType,
+		Reason:       model.ADJUSTMENT,
+		Asset:        model.SAT,
+		Description:  "Reconciliation adjustment",
+		Time:         now.Unix(),
+		TimeMs:       now.UnixMilli(),
+		Amount:       amount,
+		UserID:       drift.UserID,
+		BalanceAfter: &wallet,
+	})
+	if err != nil {
+		return err
+	}
+	detail := fmt.Sprintf("wallet %d, transactions %d, %s %d", drift.Wallet, drift.TransactionBalance, transactionType, amount)
+	return audit(tx, actorID, model.RECONCILE_WALLET, drift.UserID, reason, detail)
+}
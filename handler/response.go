@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/promisefemi/apexnetwork-take-home/model"
+)
+
+// Machine readable error codes, returned next to Message
+const (
+	CodeInvalidRequest     string = "invalid_request"
+	CodeUnauthorized       string = "unauthorized"
+	CodeInvalidCredentials string = "invalid_credentials"
+	CodeUsernameTaken      string = "username_taken"
+	CodeForbidden          string = "forbidden"
+	CodeAccountFrozen      string = "account_frozen"
+	CodeUserNotFound       string = "user_not_found"
+	CodeGameInProgress     string = "game_in_progress"
+	CodeNoActiveGame       string = "no_active_game"
+	CodeInsufficientFunds  string = "insufficient_funds"
+	CodeFundingNotAllowed  string = "funding_not_allowed"
+	CodeRollNotFound       string = "roll_not_found"
+	CodeGameNotFound       string = "game_not_found"
+	CodeGameEnded          string = "game_ended"
+	CodeSeedNotRevealed    string = "seed_not_revealed"
+	CodeRollNotVerifiable  string = "roll_not_verifiable"
+	CodeIdempotencyReused  string = "idempotency_key_reused"
+	CodeIdempotencyPending string = "idempotency_key_in_progress"
+	CodeRequestTooLarge    string = "request_too_large"
+	CodeInternal           string = "internal_error"
+)
+
+// ERRORS
+var (
+	ErrNameRequired     error = errors.New("Please complete both first and last name")
+	ErrInvalidBody      error = errors.New("unable to read request body, send JSON or a url encoded form")
+	ErrUnableToRegister error = errors.New("Something went wrong, unable to create new user")
+)
+
+type apiError struct {
+	status int
+	code   string
+}
+
+// HTTP status and error code of every error a handler can return, anything else is an internal error
+var apiErrors = map[error]apiError{
+	ErrNameRequired:             {http.StatusBadRequest, CodeInvalidRequest},
+	ErrInvalidBody:              {http.StatusBadRequest, CodeInvalidRequest},
+	ErrInvalidVerifyRequest:     {http.StatusBadRequest, CodeInvalidRequest},
+	ErrCredentialsRequired:      {http.StatusBadRequest, CodeInvalidRequest},
+	ErrInvalidUsername:          {http.StatusBadRequest, CodeInvalidRequest},
+	ErrInvalidPassword:          {http.StatusBadRequest, CodeInvalidRequest},
+	ErrNotLoginSession:          {http.StatusBadRequest, CodeInvalidRequest},
+	ErrReasonRequired:           {http.StatusBadRequest, CodeInvalidRequest},
+	ErrInvalidRole:              {http.StatusBadRequest, CodeInvalidRequest},
+	ErrInvalidLimit:             {http.StatusBadRequest, CodeInvalidRequest},
+	ErrInvalidCursor:            {http.StatusBadRequest, CodeInvalidRequest},
+	ErrInvalidFilter:            {http.StatusBadRequest, CodeInvalidRequest},
+	ErrInvalidFormat:            {http.StatusBadRequest, CodeInvalidRequest},
+	ErrInvalidAsset:             {http.StatusBadRequest, CodeInvalidRequest},
+	ErrInvalidAmount:            {http.StatusBadRequest, CodeInvalidRequest},
+	ErrInvalidRules:             {http.StatusBadRequest, CodeInvalidRequest},
+	ErrInvalidStake:             {http.StatusBadRequest, CodeInvalidRequest},
+	ErrUnauthorized:             {http.StatusUnauthorized, CodeUnauthorized},
+	ErrInvalidLogin:             {http.StatusUnauthorized, CodeInvalidCredentials},
+	ErrUsernameTaken:            {http.StatusConflict, CodeUsernameTaken},
+	ErrForbidden:                {http.StatusForbidden, CodeForbidden},
+	ErrAccountFrozen:            {http.StatusForbidden, CodeAccountFrozen},
+	ErrUserNotExist:             {http.StatusNotFound, CodeUserNotFound},
+	ErrRollNotExist:             {http.StatusNotFound, CodeRollNotFound},
+	ErrGameNotExist:             {http.StatusNotFound, CodeGameNotFound},
+	ErrGameAlreadyEnded:         {http.StatusConflict, CodeGameEnded},
+	ErrSessionIDRequired:        {http.StatusBadRequest, CodeInvalidRequest},
+	ErrNoGameInSession:          {http.StatusNotFound, CodeNoActiveGame},
+	ErrGameInSession:            {http.StatusConflict, CodeGameInProgress},
+	ErrFundingNotAllowed:        {http.StatusConflict, CodeFundingNotAllowed},
+	ErrAssetNotFundable:         {http.StatusConflict, CodeFundingNotAllowed},
+	ErrAssetNotGrantable:        {http.StatusConflict, CodeFundingNotAllowed},
+	ErrSeedNotRevealed:          {http.StatusConflict, CodeSeedNotRevealed},
+	ErrRollNotVerifiable:        {http.StatusConflict, CodeRollNotVerifiable},
+	ErrIdempotencyKeyInProgress: {http.StatusConflict, CodeIdempotencyPending},
+	ErrInsufficientFundsToStart: {http.StatusPaymentRequired, CodeInsufficientFunds},
+	ErrInsufficientFundsToRoll:  {http.StatusPaymentRequired, CodeInsufficientFunds},
+	ErrRequestTooLarge:          {http.StatusRequestEntityTooLarge, CodeRequestTooLarge},
+	ErrIdempotencyKeyReused:     {http.StatusUnprocessableEntity, CodeIdempotencyReused},
+}
+
+// Write a failed response, the status code and error code are looked up from err
+func (p *PageHandler) fail(rw http.ResponseWriter, err error, data any) {
+	e, ok := apiErrors[err]
+	if !ok {
+		e = apiError{http.StatusInternalServerError, CodeInternal}
+	}
+	p.respond(rw, e.status, model.ApiResponse{
+		Status:  false,
+		Message: err.Error(),
+		Code:    e.code,
+		Data:    data,
+	})
+}
+
+// Write a successful response
+func (p *PageHandler) success(rw http.ResponseWriter, message string, data any) {
+	p.respond(rw, http.StatusOK, model.ApiResponse{
+		Status:  true,
+		Message: message,
+		Data:    data,
+	})
+}
+
+func (p *PageHandler) respond(rw http.ResponseWriter, status int, response model.ApiResponse) {
+	jsonByte, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("error encoding response - %s", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_, _ = rw.Write(jsonByte)
+}
+
+// params holds request input from a JSON body, a url encoded or multipart form, and the query string
+type params map[string]string
+
+// Read request input, JSON bodies are used when the request says so, forms otherwise
+func readParams(r *http.Request) (params, error) {
+	input := params{}
+	for name, values := range r.URL.Query() {
+		if len(values) > 0 {
+			input[name] = values[0]
+		}
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch contentType {
+	case "application/json":
+		var body map[string]any
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		//An empty body is fine, every field is optional or read from elsewhere
+		if err := decoder.Decode(&body); err != nil && err != io.EOF {
+			return nil, ErrInvalidBody
+		}
+		for name, value := range body {
+			switch v := value.(type) {
+			case string:
+				input[name] = v
+			case json.Number, bool:
+				input[name] = fmt.Sprint(v)
+			}
+		}
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(maxIdempotentBody); err != nil {
+			return nil, ErrInvalidBody
+		}
+		for name, values := range r.PostForm {
+			if len(values) > 0 {
+				input[name] = values[0]
+			}
+		}
+	default:
+		if err := r.ParseForm(); err != nil {
+			return nil, ErrInvalidBody
+		}
+		for name, values := range r.PostForm {
+			if len(values) > 0 {
+				input[name] = values[0]
+			}
+		}
+	}
+	return input, nil
+}
+
+// First non empty value among names, lets the JSON API use camelCase while forms keep their old names
+func (input params) get(names ...string) string {
+	for _, name := range names {
+		if value := input[name]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Legacy keeps the unversioned routes answering 200 for every outcome, as they always have
+func Legacy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), legacyContextKey, true)
+		next.ServeHTTP(legacyWriter{rw}, r.WithContext(ctx))
+	})
+}
+
+// Reports whether the request came in on an unversioned route, for the few handlers whose response changed shape under /v1
+func isLegacy(r *http.Request) bool {
+	legacy, _ := r.Context().Value(legacyContextKey).(bool)
+	return legacy
+}
+
+type legacyWriter struct {
+	http.ResponseWriter
+}
+
+func (l legacyWriter) WriteHeader(int) {
+	l.ResponseWriter.WriteHeader(http.StatusOK)
+}
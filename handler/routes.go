@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+)
+
+// Routes mounts the api under /v1, with real status codes and JSON bodies,
+// and again on the old unversioned paths where every response stays a 200.
+// The admin api only exists under /v1
+func (p *PageHandler) Routes() http.Handler {
+	router := chi.NewMux()
+	router.Route("/v1", func(r chi.Router) {
+		p.mount(r)
+		r.Route("/admin", p.mountAdmin)
+	})
+	router.Group(func(r chi.Router) {
+		r.Use(Legacy)
+		p.mount(r)
+	})
+	return router
+}
+
+func (p *PageHandler) mount(r chi.Router) {
+	r.Post("/register", p.Register)
+	r.Post("/login", p.Login)
+	r.Get("/verify-roll", p.VerifyRoll)
+
+	//Everything else acts on the wallet of the player holding the API key or login token
+	r.Group(func(r chi.Router) {
+		r.Use(p.Authenticate)
+		r.Post("/logout", p.Logout)
+		r.With(p.Idempotent).Post("/fund-wallet", p.FundWallet)
+		r.Get("/get-wallet-balance", p.GetWalletBalance)
+		r.With(p.Idempotent).Post("/roll-dice", p.Roll)
+		r.Post("/end-game", p.EndGame)
+		r.With(p.Idempotent).Post("/start-game", p.StartGame)
+		r.Get("/check-active-game", p.CheckActiveGame)
+		r.Get("/games", p.Games)
+		r.Get("/games/{sessionID}", p.Game)
+		r.Get("/transactions", p.Transactions)
+	})
+}
+
+func (p *PageHandler) mountAdmin(r chi.Router) {
+	r.Use(p.Authenticate, p.RequireAdmin)
+	r.Get("/users", p.AdminListUsers)
+	r.Get("/users/{userID}", p.AdminGetUser)
+	r.Get("/users/{userID}/transactions", p.AdminUserTransactions)
+	r.Get("/users/{userID}/games", p.AdminUserGames)
+	r.Post("/users/{userID}/freeze", p.AdminFreezeUser)
+	r.Post("/users/{userID}/unfreeze", p.AdminUnfreezeUser)
+	r.Post("/users/{userID}/end-game", p.AdminEndGame)
+	r.Post("/users/{userID}/credit", p.AdminGrantCredit)
+	r.Get("/audit", p.AdminAuditLog)
+	r.Get("/ledger", p.AdminLedger)
+	r.Get("/export", p.AdminExport)
+}
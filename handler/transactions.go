@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/store"
+)
+
+// Transaction page settings
+const (
+	defaultTransactionLimit int = 50
+	maxTransactionLimit     int = 200
+)
+
+// ERRORS
+var (
+	ErrInvalidCursor error = errors.New("cursor is not valid, use the nextCursor of the previous page")
+	ErrInvalidFilter error = errors.New("invalid filter, type is CREDIT or DEBIT, order is newest or oldest, from and to are unix milliseconds or RFC3339 times")
+)
+
+// Read limit, cursor, type, reason, asset, from, to and order from the query string
+func readTransactionQuery(r *http.Request, userID string) (store.TransactionQuery, error) {
+	values := r.URL.Query()
+	query := store.TransactionQuery{
+		UserID: userID,
+		Type:   model.TransactionType(strings.ToUpper(values.Get("type"))),
+		Reason: model.TransactionReason(strings.ToLower(values.Get("reason"))),
+		Limit:  defaultTransactionLimit,
+	}
+	if query.Type != "" && query.Type != model.CREDIT && query.Type != model.DEBIT {
+		return query, ErrInvalidFilter
+	}
+	var err error
+	if query.Asset, err = readAsset(params{"asset": values.Get("asset")}); err != nil {
+		return query, err
+	}
+
+	switch values.Get("order") {
+	case "", "newest":
+	case "oldest":
+		query.Ascending = true
+	default:
+		return query, ErrInvalidFilter
+	}
+
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return query, ErrInvalidLimit
+		}
+		if limit > maxTransactionLimit {
+			limit = maxTransactionLimit
+		}
+		query.Limit = limit
+	}
+
+	if query.From, err = ParseTimeMs(values.Get("from")); err != nil {
+		return query, err
+	}
+	if query.To, err = ParseTimeMs(values.Get("to")); err != nil {
+		return query, err
+	}
+	if query.AfterID, err = decodeCursor(values.Get("cursor")); err != nil {
+		return query, err
+	}
+	return query, nil
+}
+
+// ParseTimeMs reads unix milliseconds or an RFC3339 time, empty is no bound
+func ParseTimeMs(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return ms, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, ErrInvalidFilter
+	}
+	return t.UnixMilli(), nil
+}
+
+// Cursors are opaque to clients, they hold the ID of the last transaction of the page
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id < 1 {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}
+
+// Fetch one page, one transaction more than the limit is read to know whether another page follows
+func readTransactionPage(tx store.Tx, query store.TransactionQuery) (*model.TransactionPage, error) {
+	limit := query.Limit
+	query.Limit++
+	transactions, err := tx.QueryTransactions(query)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &model.TransactionPage{Transactions: transactions}
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		page.NextCursor = encodeCursor(page.Transactions[limit-1].ID)
+	}
+	return page, nil
+}
+
+// Answer with one page of the transactions of userID
+func (p *PageHandler) pagedTransactions(rw http.ResponseWriter, r *http.Request, userID string) {
+	query, err := readTransactionQuery(r, userID)
+	if err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+
+	var page *model.TransactionPage
+	err = p.store.View(func(tx store.Tx) error {
+		if _, err := getUser(tx, userID); err != nil {
+			return err
+		}
+		var err error
+		page, err = readTransactionPage(tx, query)
+		if err != nil {
+			log.Printf("error listing transactions - %s", err)
+			return ErrNoTransactionsAvailable
+		}
+		return nil
+	})
+	if err != nil {
+		p.fail(rw, err, nil)
+		return
+	}
+
+	p.success(rw, "", page)
+	return
+}
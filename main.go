@@ -1,34 +1,349 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
-	"github.com/boltdb/bolt"
-	"github.com/go-chi/chi"
+	"github.com/promisefemi/apexnetwork-take-home/config"
+	"github.com/promisefemi/apexnetwork-take-home/dice"
 	"github.com/promisefemi/apexnetwork-take-home/handler"
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/store"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
 func main() {
-	port := ":9000"
-	db, err := bolt.Open("my.db", 0600, nil)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import-bolt":
+			importBolt(os.Args[2:])
+			return
+		case "migrate-ids":
+			migrateIDs(os.Args[2:])
+			return
+		case "issue-key":
+			issueKey(os.Args[2:])
+			return
+		case "set-role":
+			setRole(os.Args[2:])
+			return
+		case "ledger":
+			ledgerReport(os.Args[2:])
+			return
+		case "reconcile":
+			reconcile(os.Args[2:])
+			return
+		case "export":
+			export(os.Args[2:])
+			return
+		}
+	}
+
+	defaults := config.Default()
+	configPath := flag.String("config", "", "JSON config file, flags given on the command line override it")
+	port := flag.String("port", defaults.Port, "address to listen on")
+	backend := flag.String("store", defaults.Store, "storage backend, bolt or sqlite")
+	dbPath := flag.String("db", defaults.DB, "database file path")
+	reconcileEvery := flag.Duration("reconcile", time.Hour, "how often wallets are checked against their transactions, 0 turns it off")
+	flag.Parse()
+
+	cfg := defaults
+	if *configPath != "" {
+		var err error
+		if cfg, err = config.Load(*configPath); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	fileConfig := cfg
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.Port = *port
+		case "store":
+			cfg.Store = *backend
+		case "db":
+			cfg.DB = *dbPath
+		}
+	})
+	if err := cfg.Validate(); err != nil {
+		log.Fatalln(err)
+	}
+
+	db, err := openStore(cfg.Store, cfg.DB)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	router := chi.NewMux()
-	pageHandler := handler.NewPageHandler(db)
+	defer db.Close()
+	pageHandler := handler.NewPageHandler(db, dice.NewCryptoRoller())
+	pageHandler.SetEconomy(cfg.Economy)
+
+	//Reload the economy on SIGHUP, a config that does not validate leaves the running one in place
+	if *configPath != "" {
+		hangup := make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+		go func() {
+			for range hangup {
+				next, err := config.Load(*configPath)
+				if err != nil {
+					log.Printf("error reloading config, keeping the current one - %s", err)
+					continue
+				}
+				pageHandler.SetEconomy(next.Economy)
+				log.Printf("reloaded config %s - %+v", *configPath, next.Economy)
+				if next.Port != fileConfig.Port || next.Store != fileConfig.Store || next.DB != fileConfig.DB {
+					log.Printf("port, store and db changes apply after a restart")
+				}
+			}
+		}()
+	}
+	//Balances from before the ledger existed become opening entries
+	if opened, err := pageHandler.OpenWallets(); err != nil {
+		log.Fatalln(err)
+	} else if opened > 0 {
+		log.Printf("opened %d wallet accounts in the ledger", opened)
+	}
+	//Games from before their totals were kept are totalled once
+	if totalled, err := pageHandler.TotalGames(); err != nil {
+		log.Fatalln(err)
+	} else if totalled > 0 {
+		log.Printf("totalled %d games", totalled)
+	}
 
-	router.Post("/register", pageHandler.Register)
-	router.Post("/fund-wallet", pageHandler.FundWallet)
-	router.Get("/get-wallet-balance", pageHandler.GetWalletBalance)
-	router.Post("/roll-dice", pageHandler.Roll)
-	router.Post("/end-game", pageHandler.EndGame)
-	router.Post("/start-game", pageHandler.StartGame)
-	router.Get("/check-active-game", pageHandler.CheckActiveGame)
-	router.Get("/transactions", pageHandler.Transactions)
+	//Drop idempotency keys once they fall out of the retention window, and login sessions once they expire
+	go func() {
+		for range time.Tick(time.Hour) {
+			if removed, err := pageHandler.PruneIdempotencyKeys(); err != nil {
+				log.Printf("error pruning idempotency keys - %s", err)
+			} else if removed > 0 {
+				log.Printf("pruned %d idempotency keys", removed)
+			}
+			if removed, err := pageHandler.PruneAuthSessions(); err != nil {
+				log.Printf("error pruning login sessions - %s", err)
+			} else if removed > 0 {
+				log.Printf("pruned %d login sessions", removed)
+			}
+		}
+	}()
 
-	fmt.Printf("Server listening on port: %s", port)
-	if err := http.ListenAndServe(port, router); err != nil {
+	//Report wallets that drifted from their transactions, correcting them is left to the reconcile command
+	if *reconcileEvery > 0 {
+		go func() {
+			for range time.Tick(*reconcileEvery) {
+				report, err := pageHandler.Reconcile("", "", false)
+				if err != nil {
+					log.Printf("error reconciling wallets - %s", err)
+					continue
+				}
+				if len(report.Mismatches) > 0 {
+					mismatches, _ := json.Marshal(report.Mismatches)
+					log.Printf("%d wallets drifted from their transactions - %s", len(report.Mismatches), mismatches)
+				}
+			}
+		}()
+	}
+
+	fmt.Printf("Server listening on port: %s", cfg.Port)
+	if err := http.ListenAndServe(cfg.Port, pageHandler.Routes()); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// Open storage backend by name
+func openStore(backend, path string) (store.Store, error) {
+	switch backend {
+	case "bolt":
+		return store.OpenBolt(path)
+	case "sqlite":
+		return store.OpenSQLite(path)
+	}
+	return nil, fmt.Errorf("unknown store %q, use bolt or sqlite", backend)
+}
+
+// import-bolt copies an existing bolt file into a new sqlite database
+func importBolt(args []string) {
+	fs := flag.NewFlagSet("import-bolt", flag.ExitOnError)
+	from := fs.String("from", "my.db", "bolt database to read")
+	to := fs.String("to", "my.sqlite", "sqlite database to write")
+	_ = fs.Parse(args)
+
+	dst, err := store.OpenSQLite(*to)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer dst.Close()
+
+	stats, err := store.ImportBolt(*from, dst)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	_ = json.NewEncoder(os.Stdout).Encode(stats)
+}
+
+// migrate-ids rewrites game and roll sessions that still carry the old random integer IDs
+func migrateIDs(args []string) {
+	fs := flag.NewFlagSet("migrate-ids", flag.ExitOnError)
+	dbPath := fs.String("db", "my.db", "bolt database to migrate")
+	_ = fs.Parse(args)
+
+	db, err := store.OpenBolt(*dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+
+	stats, err := db.MigrateLegacyIDs()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	_ = json.NewEncoder(os.Stdout).Encode(stats)
+}
+
+// issue-key prints a new API key for an existing user, for players registered before API keys existed
+func issueKey(args []string) {
+	fs := flag.NewFlagSet("issue-key", flag.ExitOnError)
+	backend := fs.String("store", "bolt", "storage backend, bolt or sqlite")
+	dbPath := fs.String("db", "my.db", "database file path")
+	userID := fs.String("user", "", "ID of the user to issue a key for")
+	_ = fs.Parse(args)
+
+	if *userID == "" {
+		log.Fatalln("-user is required")
+	}
+	db, err := openStore(*backend, *dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+
+	key, err := handler.NewPageHandler(db, dice.NewCryptoRoller()).IssueApiKey(*userID)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Println(key)
+}
+
+// set-role makes a user an admin or a player again, the change is recorded in the audit log
+func setRole(args []string) {
+	fs := flag.NewFlagSet("set-role", flag.ExitOnError)
+	backend := fs.String("store", "bolt", "storage backend, bolt or sqlite")
+	dbPath := fs.String("db", "my.db", "database file path")
+	userID := fs.String("user", "", "ID of the user")
+	role := fs.String("role", string(model.ADMIN), "new role, PLAYER or ADMIN")
+	reason := fs.String("reason", "", "why the role is changed, kept in the audit log")
+	_ = fs.Parse(args)
+
+	if *userID == "" {
+		log.Fatalln("-user is required")
+	}
+	db, err := openStore(*backend, *dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+
+	pageHandler := handler.NewPageHandler(db, dice.NewCryptoRoller())
+	if err := pageHandler.SetRole(handler.CLIActor, *userID, model.Role(strings.ToUpper(*role)), *reason); err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Printf("%s is now %s\n", *userID, strings.ToUpper(*role))
+}
+
+// ledger prints the ledger check and house profit and loss per asset as JSON, exits with status 1 when the ledger does not balance
+func ledgerReport(args []string) {
+	fs := flag.NewFlagSet("ledger", flag.ExitOnError)
+	backend := fs.String("store", "bolt", "storage backend, bolt or sqlite")
+	dbPath := fs.String("db", "my.db", "database file path")
+	_ = fs.Parse(args)
+
+	db, err := openStore(*backend, *dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+
+	report, err := handler.NewPageHandler(db, dice.NewCryptoRoller()).LedgerReport()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	_ = json.NewEncoder(os.Stdout).Encode(report)
+	for _, profit := range report.HouseProfitByAsset {
+		log.Printf("house profit %d %s", profit.Balance, profit.Asset)
+	}
+	if !report.Balanced {
+		db.Close()
+		os.Exit(1)
+	}
+}
+
+// reconcile recomputes every wallet from its transactions and prints the drift as JSON.
+// With -fix it writes correcting transactions, otherwise it exits with status 1 when any wallet drifted
+func reconcile(args []string) {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	backend := fs.String("store", "bolt", "storage backend, bolt or sqlite")
+	dbPath := fs.String("db", "my.db", "database file path")
+	fix := fs.Bool("fix", false, "write a correcting transaction for every wallet that drifted")
+	reason := fs.String("reason", "", "why the corrections are made, kept in the audit log, required with -fix")
+	_ = fs.Parse(args)
+
+	db, err := openStore(*backend, *dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+
+	report, err := handler.NewPageHandler(db, dice.NewCryptoRoller()).Reconcile(handler.CLIActor, *reason, *fix)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	_ = json.NewEncoder(os.Stdout).Encode(report)
+	if !*fix && len(report.Mismatches) > 0 {
+		db.Close()
+		os.Exit(1)
+	}
+}
+
+// export writes the statement of one or every user to stdout or a file, as CSV or NDJSON
+func export(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	backend := fs.String("store", "bolt", "storage backend, bolt or sqlite")
+	dbPath := fs.String("db", "my.db", "database file path")
+	userID := fs.String("user", "", "ID of the user to export, every user when empty")
+	from := fs.String("from", "", "first time to include, unix milliseconds or RFC3339")
+	to := fs.String("to", "", "time to stop before, unix milliseconds or RFC3339")
+	format := fs.String("format", handler.ExportCSV, "csv or ndjson")
+	out := fs.String("out", "", "file to write, stdout when empty")
+	_ = fs.Parse(args)
+
+	options := handler.ExportOptions{UserID: *userID, Format: *format}
+	var err error
+	if options.From, err = handler.ParseTimeMs(*from); err != nil {
+		log.Fatalln(err)
+	}
+	if options.To, err = handler.ParseTimeMs(*to); err != nil {
+		log.Fatalln(err)
+	}
+
+	db, err := openStore(*backend, *dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer db.Close()
+
+	w := os.Stdout
+	if *out != "" {
+		w, err = os.Create(*out)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer w.Close()
+	}
+	if err := handler.NewPageHandler(db, dice.NewCryptoRoller()).Export(w, options); err != nil {
 		log.Fatalln(err)
 	}
 }
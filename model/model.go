@@ -3,6 +3,7 @@ package model
 type ApiResponse struct {
 	Status  bool        `json:"status"`
 	Message string      `json:"message"`
+	Code    string      `json:"code,omitempty"`
 	Data    interface{} `json:"data,omitempty"`
 }
 
@@ -12,27 +13,245 @@ type User struct {
 	UserID    string `json:"userID"`
 	Wallet    int    `json:"wallet"`
 	Asset     string `json:"asset"`
+	Username  string `json:"username,omitempty"`
+	Role      Role   `json:"role,omitempty"`
+	// Frozen accounts cannot start games, roll or fund their wallet
+	Frozen bool `json:"frozen,omitempty"`
+}
+
+// User with their balance in every asset
+type Wallet struct {
+	User
+	Balances []AssetBalance `json:"balances"`
+}
+
+type AssetBalance struct {
+	Asset   Asset `json:"asset"`
+	Balance int   `json:"balance"`
+}
+
+// Currency a balance is held in, User.Wallet is the sat balance
+type Asset string
+
+const (
+	SAT Asset = "sat"
+	// Promotional credit, spent before sats on game costs
+	BONUS Asset = "bonus"
+	// Loyalty points currency
+	POINTS Asset = "points"
+)
+
+// Every asset a wallet can hold, in the order balances are listed
+var Assets = []Asset{SAT, BONUS, POINTS}
+
+type Role string
+
+const (
+	PLAYER Role = "PLAYER"
+	ADMIN  Role = "ADMIN"
+)
+
+// Users stored before roles existed have no role and are players
+func (u User) IsAdmin() bool {
+	return u.Role == ADMIN
+}
+
+// Returned once by Register, the API key is not stored and cannot be shown again
+type Registration struct {
+	User
+	ApiKey string `json:"apiKey"`
+}
+
+// API key of a user, only the sha256 hash of the key is stored
+type ApiKey struct {
+	KeyHash   string `json:"keyHash"`
+	UserID    string `json:"userID"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// Username and bcrypt password hash a player logs in with, kept apart from User so the hash never ends up in a response
+type Credential struct {
+	Username     string `json:"username"`
+	UserID       string `json:"userID"`
+	PasswordHash string `json:"passwordHash"`
+	CreatedAt    int64  `json:"createdAt"`
+}
+
+// Server side login session, only the sha256 hash of the token is stored
+type AuthSession struct {
+	TokenHash string `json:"tokenHash"`
+	UserID    string `json:"userID"`
+	CreatedAt int64  `json:"createdAt"`
+	ExpiresAt int64  `json:"expiresAt"`
+	// Set by logout, a revoked session is rejected even before it expires
+	RevokedAt int64 `json:"revokedAt,omitempty"`
+}
+
+// Returned by login, the token is not stored and cannot be shown again
+type Login struct {
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expiresAt"`
+	Username  string `json:"username"`
+	User      User   `json:"user"`
 }
 
 type Transaction struct {
-	Type        TransactionType `json:"type"`
-	Description string          `json:"description"`
-	Time        int64           `json:"time"`
-	Amount      int             `json:"amount"`
-	UserID      string          `json:"userID"`
+	// Sequence number given by the store, increases with every transaction
+	ID          int64             `json:"id"`
+	Type        TransactionType   `json:"type"`
+	Reason      TransactionReason `json:"reason,omitempty"`
+	Asset       Asset             `json:"asset"`
+	Description string            `json:"description"`
+	// Unix seconds, kept for existing clients, TimeMs has the same moment in milliseconds
+	Time   int64  `json:"time"`
+	TimeMs int64  `json:"timeMs"`
+	Amount int    `json:"amount"`
+	UserID string `json:"userID"`
+	// Journal entry that moved the money, empty for adjustments that only correct the history
+	EntryID   string `json:"entryID,omitempty"`
+	SessionID string `json:"sessionID,omitempty"`
+	RollID    string `json:"rollID,omitempty"`
+	// Balance of Asset right after the transaction, unknown for transactions written before it was recorded
+	BalanceAfter *int `json:"balanceAfter,omitempty"`
 }
 
 type TransactionType string
 
+// Transaction as written to a statement export, with the wallet of its user right after it
+type StatementLine struct {
+	Transaction
+	// BalanceAfter when it was recorded, otherwise CREDIT minus DEBIT over the history of the user in the asset up to here
+	RunningBalance int `json:"runningBalance"`
+}
+
+// One page of transactions, NextCursor fetches the page after it and is empty on the last page
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor   string        `json:"nextCursor,omitempty"`
+}
+
+// Why the wallet moved
+type TransactionReason string
+
+// Balanced entry of the double entry ledger, the postings of an entry always sum to zero
+type JournalEntry struct {
+	ID          string    `json:"id"`
+	Time        int64     `json:"time"`
+	Description string    `json:"description"`
+	Postings    []Posting `json:"postings"`
+}
+
+// Amount moved into Account, negative when it moves out
+type Posting struct {
+	Account string `json:"account"`
+	Amount  int    `json:"amount"`
+}
+
+// Reports whether the entry moves money between at least two postings and creates or loses none
+func (e JournalEntry) Balanced() bool {
+	if len(e.Postings) < 2 {
+		return false
+	}
+	sum := 0
+	for _, posting := range e.Postings {
+		sum += posting.Amount
+	}
+	return sum == 0
+}
+
+type AccountBalance struct {
+	Account string `json:"account"`
+	Balance int    `json:"balance"`
+}
+
+// Result of checking the ledger against itself and against the user wallets
+type LedgerReport struct {
+	Time int64 `json:"time"`
+	// True when every account adds up and all accounts together sum to zero
+	Balanced bool `json:"balanced"`
+	// Sat stakes taken minus winnings paid, the balance of the house account. Stakes paid with bonus credit are not in it
+	HouseProfit int `json:"houseProfit"`
+	// House profit in every asset, the balance of the house account of the asset
+	HouseProfitByAsset []AssetBalance `json:"houseProfitByAsset"`
+	// Money players have put in through wallet funding
+	TotalFunded int              `json:"totalFunded"`
+	Accounts    []AccountBalance `json:"accounts"`
+	Mismatches  []LedgerMismatch `json:"mismatches"`
+}
+
+type LedgerMismatch struct {
+	Account  string `json:"account"`
+	UserID   string `json:"userID,omitempty"`
+	Expected int    `json:"expected"`
+	Actual   int    `json:"actual"`
+	Problem  string `json:"problem"`
+}
+
+// Result of recomputing every wallet from the transactions of its user
+type ReconcileReport struct {
+	Time int64 `json:"time"`
+	// Number of users checked
+	Users      int           `json:"users"`
+	Mismatches []WalletDrift `json:"mismatches"`
+}
+
+type WalletDrift struct {
+	UserID string `json:"userID"`
+	Wallet int    `json:"wallet"`
+	// CREDIT minus DEBIT over every transaction of the user
+	TransactionBalance int `json:"transactionBalance"`
+	// Wallet minus TransactionBalance
+	Drift int `json:"drift"`
+	// True when a correcting transaction was written
+	Corrected bool `json:"corrected"`
+}
+
 const (
 	DEBIT  TransactionType = "DEBIT"
 	CREDIT TransactionType = "CREDIT"
 )
 
+const (
+	GAME_START TransactionReason = "game_start"
+	ROLL_STAKE TransactionReason = "roll_stake"
+	WIN_PAYOUT TransactionReason = "win_payout"
+	FUNDING    TransactionReason = "funding"
+	ADJUSTMENT TransactionReason = "adjustment"
+	PROMOTION  TransactionReason = "promotion"
+)
+
 type GameSession struct {
 	SessionID  string            `json:"sessionID"`
 	UserId     string            `json:"userID"`
 	GameStatus GameSessionStatus `json:"gameStatus"`
+	// Provably fair seeds, ServerSeed stays secret until the game is completed
+	ServerSeedHash string `json:"serverSeedHash,omitempty"`
+	ServerSeed     string `json:"serverSeed,omitempty"`
+	ClientSeed     string `json:"clientSeed,omitempty"`
+	// Nonce of the next roll in this game
+	Nonce int `json:"nonce"`
+	// Rule set the game is played by, empty on games from before there was more than one
+	Rules string `json:"rules,omitempty"`
+	// Unix time the game started and ended, 0 while in progress or on games from before they were recorded
+	StartedAt int64 `json:"startedAt"`
+	EndedAt   int64 `json:"endedAt"`
+	// Totals of the rounds and money of the game, kept up to date as it is played
+	RollCount int `json:"rollCount"`
+	Wins      int `json:"wins"`
+	// Everything the game cost, the start cost and the stakes of its rounds
+	Staked int `json:"staked"`
+	Won    int `json:"won"`
+	// False on games from before the totals were kept, until they are totalled from their rounds and transactions
+	Totalled bool `json:"totalled,omitempty"`
+}
+
+// Public returns the session as it can be shown to the player, the server seed is only revealed once the game is completed
+func (g GameSession) Public() GameSession {
+	if g.GameStatus != COMPLETED {
+		g.ServerSeed = ""
+	}
+	g.Totalled = false
+	return g
 }
 
 type RollSession struct {
@@ -43,6 +262,72 @@ type RollSession struct {
 	FirstRoll     int               `json:"firstRow"`
 	SecondRoll    int               `json:"secondRow"`
 	RowStatus     GameSessionStatus `json:"rowStatus"`
+	Nonce         int               `json:"nonce"`
+	// Amount staked on the round and the payout quoted after its first roll, both 0 on rounds from before stakes
+	Stake  int `json:"stake"`
+	Payout int `json:"payout"`
+	// Unix time of the first roll and of the roll that settled the round, 0 while in progress or on rounds from before they were recorded
+	StartedAt int64 `json:"startedAt"`
+	EndedAt   int64 `json:"endedAt"`
+	// Every die thrown in the round in order, so rule sets throwing more than two dice need no new fields. Empty on rounds from before it was recorded
+	Throws []int `json:"throws,omitempty"`
+	// Stake still to be taken, the roll after the quote takes it. 0 once taken, on rounds lost by their first roll
+	// and on rounds that took their stake when they started
+	StakeDue int `json:"stakeDue,omitempty"`
+}
+
+type RollPhase string
+
+const (
+	FIRST_ROLL  RollPhase = "first"
+	SECOND_ROLL RollPhase = "second"
+)
+
+// Result of one roll of the dice, clients draw the dice from it instead of reading the message
+type RollResult struct {
+	RollID        string    `json:"rollID"`
+	GameSessionID string    `json:"gameSessionID"`
+	Phase         RollPhase `json:"phase"`
+	FirstRoll     int       `json:"firstRoll"`
+	// 0 until the second roll
+	SecondRoll int `json:"secondRoll"`
+	Target     int `json:"target"`
+	// What the second die has to show to win, out of 1-6 when the target is out of reach
+	Needed int `json:"needed"`
+	// Every die thrown in the round so far
+	Throws []int `json:"throws"`
+	Won    bool  `json:"won"`
+	Payout int   `json:"payout"`
+	// Sat balance after the roll, and the balance of every asset since stakes are paid with bonus first
+	WalletBalance int            `json:"walletBalance"`
+	Balances      []AssetBalance `json:"balances"`
+	// Set while the round waits for its next roll
+	Odds *RollOdds `json:"odds,omitempty"`
+}
+
+// Odds of a round that is waiting for its next roll
+type RollOdds struct {
+	Stake int `json:"stake"`
+	// Chance the next roll wins the round
+	Probability float64 `json:"probability"`
+	// Payout as a multiple of the stake, the inverse of the probability with the house edge taken off
+	Multiplier      float64 `json:"multiplier"`
+	PotentialPayout int     `json:"potentialPayout"`
+}
+
+// Result of recomputing a roll from its seeds
+type RollVerification struct {
+	RollID         string `json:"rollID,omitempty"`
+	ServerSeed     string `json:"serverSeed"`
+	ServerSeedHash string `json:"serverSeedHash"`
+	ClientSeed     string `json:"clientSeed"`
+	Nonce          int    `json:"nonce"`
+	WinningGame    int    `json:"winningGame"`
+	FirstRoll      int    `json:"firstRoll"`
+	SecondRoll     int    `json:"secondRoll"`
+	// Set when verifying a stored roll, true if the published hash and the stored dice match the recomputed ones
+	HashMatches *bool `json:"hashMatches,omitempty"`
+	RollMatches *bool `json:"rollMatches,omitempty"`
 }
 
 type GameSessionStatus string
@@ -51,3 +336,74 @@ const (
 	INPROGRESS GameSessionStatus = "IN_PROGRESS"
 	COMPLETED  GameSessionStatus = "COMPLETED"
 )
+
+// Stored outcome of a request sent with an Idempotency-Key header
+type IdempotencyRecord struct {
+	Key         string `json:"key"`
+	RequestHash string `json:"requestHash"`
+	// StatusCode is 0 while the original request is still being processed
+	StatusCode int    `json:"statusCode"`
+	Body       []byte `json:"body"`
+	CreatedAt  int64  `json:"createdAt"`
+}
+
+// Record of an admin action, kept for as long as the database lives
+type AuditEntry struct {
+	ID     string      `json:"id"`
+	Action AuditAction `json:"action"`
+	// User ID of the acting admin, or "cli" for actions run from the command line
+	ActorID string `json:"actorID"`
+	UserID  string `json:"userID"`
+	Reason  string `json:"reason"`
+	Detail  string `json:"detail,omitempty"`
+	Time    int64  `json:"time"`
+}
+
+type AuditAction string
+
+const (
+	FREEZE_ACCOUNT   AuditAction = "FREEZE_ACCOUNT"
+	UNFREEZE_ACCOUNT AuditAction = "UNFREEZE_ACCOUNT"
+	FORCE_END_GAME   AuditAction = "FORCE_END_GAME"
+	SET_ROLE         AuditAction = "SET_ROLE"
+	RECONCILE_WALLET AuditAction = "RECONCILE_WALLET"
+	GRANT_CREDIT     AuditAction = "GRANT_CREDIT"
+
+	//Reads of player data through the admin api, the detail holds the query they were made with
+	VIEW_USERS        AuditAction = "VIEW_USERS"
+	VIEW_USER         AuditAction = "VIEW_USER"
+	VIEW_TRANSACTIONS AuditAction = "VIEW_TRANSACTIONS"
+	VIEW_GAMES        AuditAction = "VIEW_GAMES"
+	EXPORT_STATEMENT  AuditAction = "EXPORT_STATEMENT"
+)
+
+// Game session with the totals of its rounds and of the money it moved, as shown in the game history
+type GameSummary struct {
+	GameSession
+	Net int `json:"net"`
+}
+
+// One page of the games of a player, newest first
+type GamePage struct {
+	Games      []GameSummary `json:"games"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+// Summary of one game together with its rounds in the order they were played
+type GameHistory struct {
+	GameSummary
+	Rolls []RollSession `json:"rolls"`
+}
+
+// Settlement of a game as it ends, staked and won are the total debits and credits of the game
+type GameSettlement struct {
+	GameSummary
+	// Seconds from the start to the end of the game, 0 for games from before start times were recorded
+	Duration int64 `json:"duration"`
+}
+
+// Game session together with its rolls, as shown to admins
+type GameWithRolls struct {
+	GameSession
+	Rolls []RollSession `json:"rolls"`
+}
@@ -0,0 +1,568 @@
+package store
+
+import (
+	"log"
+
+	"github.com/boltdb/bolt"
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/util"
+)
+
+// Bucket names
+const (
+	UserBucket        string = "users"
+	TransactionBucket string = "transactions"
+	GameSessionBucket string = "gameSession"
+	RollSessionBucket string = "rollSession"
+	IdempotencyBucket string = "idempotency"
+	ApiKeyBucket      string = "apiKeys"      // key hash -> api key
+	CredentialBucket  string = "credentials"  // username -> credential
+	AuthSessionBucket string = "authSessions" // token hash -> login session
+	AuditBucket       string = "auditLog"     // entry ID -> audit entry
+	JournalBucket     string = "journal"      // entry ID -> journal entry
+	MarkerBucket      string = "markers"      // name -> unix time the one-off job was done
+
+	// Kept up to date by AddJournalEntry, the ledger started empty so they never need a rebuild
+	AccountBalanceBucket      string = "accountBalances"     // account -> balance
+	AccountJournalIndexBucket string = "accountJournalIndex" // account/ -> entry ID
+
+	// Index buckets, kept in the same transaction as the records they point to
+	ActiveGameIndexBucket      string = "activeGameIndex"      // userID -> active sessionID
+	ActiveRollIndexBucket      string = "activeRollIndex"      // sessionID -> active rollID
+	UserTransactionIndexBucket string = "userTransactionIndex" // userID/ -> transaction sequence
+	UserGameIndexBucket        string = "userGameIndex"        // userID/ -> sessionID
+	GameRollIndexBucket        string = "gameRollIndex"        // sessionID/ -> rollID
+)
+
+var buckets = []string{UserBucket, TransactionBucket, GameSessionBucket, RollSessionBucket, IdempotencyBucket, ApiKeyBucket, CredentialBucket, AuthSessionBucket, AuditBucket,
+	JournalBucket, AccountBalanceBucket, AccountJournalIndexBucket, MarkerBucket}
+
+var indexBuckets = []string{ActiveGameIndexBucket, ActiveRollIndexBucket, UserTransactionIndexBucket, UserGameIndexBucket, GameRollIndexBucket}
+
+// BoltStore keeps all records in a boltDB file
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// Opens boltDB file at path and returns a store backed by it
+func OpenBolt(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewBoltStore(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Create and returns new bolt store, makes sure all buckets exist.
+// Files created before the index buckets existed get their indexes built once here
+func NewBoltStore(db *bolt.DB) (*BoltStore, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range buckets {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket([]byte(ActiveGameIndexBucket)) != nil {
+			return nil
+		}
+		for _, name := range indexBuckets {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return rebuildIndexes(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltStore{db}, nil
+}
+
+func (s *BoltStore) View(fn func(tx Tx) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx})
+	})
+}
+
+func (s *BoltStore) Update(fn func(tx Tx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx})
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (b *boltTx) GetUser(userID string) (*model.User, error) {
+	var user model.User
+	if err := b.get(UserBucket, []byte(userID), &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (b *boltTx) ListUsers() ([]model.User, error) {
+	users := make([]model.User, 0)
+	err := b.tx.Bucket([]byte(UserBucket)).ForEach(func(k, v []byte) error {
+		var user model.User
+		if err := util.DecodeStruct(v, &user); err != nil {
+			log.Printf("error decoding user %s - %s", k, err)
+			return nil
+		}
+		users = append(users, user)
+		return nil
+	})
+	return users, err
+}
+
+func (b *boltTx) PutUser(user *model.User) error {
+	return b.put(UserBucket, []byte(user.UserID), user)
+}
+
+func (b *boltTx) GetApiKey(keyHash string) (*model.ApiKey, error) {
+	var key model.ApiKey
+	if err := b.get(ApiKeyBucket, []byte(keyHash), &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (b *boltTx) PutApiKey(key *model.ApiKey) error {
+	return b.put(ApiKeyBucket, []byte(key.KeyHash), key)
+}
+
+func (b *boltTx) GetCredential(username string) (*model.Credential, error) {
+	var credential model.Credential
+	if err := b.get(CredentialBucket, []byte(username), &credential); err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+func (b *boltTx) PutCredential(credential *model.Credential) error {
+	return b.put(CredentialBucket, []byte(credential.Username), credential)
+}
+
+func (b *boltTx) GetAuthSession(tokenHash string) (*model.AuthSession, error) {
+	var session model.AuthSession
+	if err := b.get(AuthSessionBucket, []byte(tokenHash), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (b *boltTx) PutAuthSession(session *model.AuthSession) error {
+	return b.put(AuthSessionBucket, []byte(session.TokenHash), session)
+}
+
+func (b *boltTx) DeleteAuthSessions(expiredBefore int64) (int, error) {
+	bucket := b.tx.Bucket([]byte(AuthSessionBucket))
+	var stale [][]byte
+	err := bucket.ForEach(func(k, v []byte) error {
+		var session model.AuthSession
+		if err := util.DecodeStruct(v, &session); err != nil || session.ExpiresAt < expiredBefore {
+			stale = append(stale, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, k := range stale {
+		if err := bucket.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return len(stale), nil
+}
+
+func (b *boltTx) AddTransaction(transaction *model.Transaction) error {
+	bucket := b.tx.Bucket([]byte(TransactionBucket))
+	id, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	transaction.ID = int64(id)
+	key := util.Itob(int(id))
+	if err := b.put(TransactionBucket, key, transaction); err != nil {
+		return err
+	}
+	return indexTransaction(b.tx, transaction.UserID, key)
+}
+
+func (b *boltTx) ListTransactions(userID string) ([]model.Transaction, error) {
+	transactions := make([]model.Transaction, 0)
+	index := b.tx.Bucket([]byte(UserTransactionIndexBucket)).Bucket([]byte(userID))
+	if index == nil {
+		return transactions, nil
+	}
+	c := index.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		var transaction model.Transaction
+		if err := b.get(TransactionBucket, k, &transaction); err != nil {
+			log.Printf("error decoding byte to struct %s", err)
+			continue
+		}
+		transaction.ID = int64(util.Btoi(k))
+		upgradeTransaction(&transaction)
+		transactions = append(transactions, transaction)
+	}
+	return transactions, nil
+}
+
+func (b *boltTx) EachTransaction(userID string, fn func(transaction *model.Transaction) error) error {
+	//Every user walks the transactions bucket itself, one user walks their index
+	c := b.tx.Bucket([]byte(TransactionBucket)).Cursor()
+	if userID != "" {
+		index := b.tx.Bucket([]byte(UserTransactionIndexBucket)).Bucket([]byte(userID))
+		if index == nil {
+			return nil
+		}
+		c = index.Cursor()
+	}
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		var transaction model.Transaction
+		if err := b.get(TransactionBucket, k, &transaction); err != nil {
+			log.Printf("error decoding byte to struct %s", err)
+			continue
+		}
+		transaction.ID = int64(util.Btoi(k))
+		upgradeTransaction(&transaction)
+		if err := fn(&transaction); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *boltTx) QueryTransactions(query TransactionQuery) ([]model.Transaction, error) {
+	transactions := make([]model.Transaction, 0)
+	index := b.tx.Bucket([]byte(UserTransactionIndexBucket)).Bucket([]byte(query.UserID))
+	if index == nil {
+		return transactions, nil
+	}
+
+	//Walk the index of the user from the cursor in the requested order, keys are the big endian transaction IDs
+	c := index.Cursor()
+	var k []byte
+	switch {
+	case query.AfterID == 0 && query.Ascending:
+		k, _ = c.First()
+	case query.AfterID == 0:
+		k, _ = c.Last()
+	case query.Ascending:
+		k, _ = c.Seek(util.Itob(int(query.AfterID) + 1))
+	default:
+		//Seek lands on the cursor itself or the first key after it, one step back is the next page
+		if k, _ = c.Seek(util.Itob(int(query.AfterID))); k == nil {
+			k, _ = c.Last()
+		} else {
+			k, _ = c.Prev()
+		}
+	}
+	next := c.Prev
+	if query.Ascending {
+		next = c.Next
+	}
+
+	for ; k != nil; k, _ = next() {
+		var transaction model.Transaction
+		if err := b.get(TransactionBucket, k, &transaction); err != nil {
+			log.Printf("error decoding byte to struct %s", err)
+			continue
+		}
+		transaction.ID = int64(util.Btoi(k))
+		upgradeTransaction(&transaction)
+		if !query.matches(&transaction) {
+			continue
+		}
+		transactions = append(transactions, transaction)
+		if len(transactions) == query.Limit {
+			break
+		}
+	}
+	return transactions, nil
+}
+
+func (b *boltTx) GetGameSession(sessionID string) (*model.GameSession, error) {
+	var session model.GameSession
+	if err := b.get(GameSessionBucket, []byte(sessionID), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (b *boltTx) GetActiveGame(userID string) (*model.GameSession, error) {
+	sessionID := b.tx.Bucket([]byte(ActiveGameIndexBucket)).Get([]byte(userID))
+	if sessionID == nil {
+		return nil, ErrNotFound
+	}
+	return b.GetGameSession(string(sessionID))
+}
+
+func (b *boltTx) ListGameSessions(userID string) ([]model.GameSession, error) {
+	sessions := make([]model.GameSession, 0)
+	index := b.tx.Bucket([]byte(UserGameIndexBucket)).Bucket([]byte(userID))
+	if index == nil {
+		return sessions, nil
+	}
+	c := index.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		var session model.GameSession
+		if err := b.get(GameSessionBucket, k, &session); err != nil {
+			log.Printf("error unable to parse game session - %s", err)
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+func (b *boltTx) QueryGameSessions(query GameQuery) ([]model.GameSession, error) {
+	sessions := make([]model.GameSession, 0)
+	index := b.tx.Bucket([]byte(UserGameIndexBucket)).Bucket([]byte(query.UserID))
+	if index == nil {
+		return sessions, nil
+	}
+
+	//Walk the index of the user backwards from the cursor, keys are the session IDs
+	c := index.Cursor()
+	var k []byte
+	if query.BeforeID == "" {
+		k, _ = c.Last()
+	} else if k, _ = c.Seek([]byte(query.BeforeID)); k == nil {
+		k, _ = c.Last()
+	} else {
+		k, _ = c.Prev()
+	}
+	for ; k != nil; k, _ = c.Prev() {
+		var session model.GameSession
+		if err := b.get(GameSessionBucket, k, &session); err != nil {
+			log.Printf("error unable to parse game session - %s", err)
+			continue
+		}
+		sessions = append(sessions, session)
+		if len(sessions) == query.Limit {
+			break
+		}
+	}
+	return sessions, nil
+}
+
+func (b *boltTx) PutGameSession(session *model.GameSession) error {
+	if err := b.put(GameSessionBucket, []byte(session.SessionID), session); err != nil {
+		return err
+	}
+	return indexGameSession(b.tx, session)
+}
+
+func (b *boltTx) GetRollSession(rollID string) (*model.RollSession, error) {
+	var roll model.RollSession
+	if err := b.get(RollSessionBucket, []byte(rollID), &roll); err != nil {
+		return nil, err
+	}
+	return &roll, nil
+}
+
+func (b *boltTx) GetActiveRoll(gameSessionID string) (*model.RollSession, error) {
+	rollID := b.tx.Bucket([]byte(ActiveRollIndexBucket)).Get([]byte(gameSessionID))
+	if rollID == nil {
+		return nil, ErrNotFound
+	}
+	var roll model.RollSession
+	if err := b.get(RollSessionBucket, rollID, &roll); err != nil {
+		return nil, err
+	}
+	return &roll, nil
+}
+
+func (b *boltTx) ListRollSessions(gameSessionID string) ([]model.RollSession, error) {
+	rolls := make([]model.RollSession, 0)
+	index := b.tx.Bucket([]byte(GameRollIndexBucket)).Bucket([]byte(gameSessionID))
+	if index == nil {
+		return rolls, nil
+	}
+	c := index.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		var roll model.RollSession
+		if err := b.get(RollSessionBucket, k, &roll); err != nil {
+			log.Printf("unable to parse session - %s", err)
+			continue
+		}
+		rolls = append(rolls, roll)
+	}
+	return rolls, nil
+}
+
+func (b *boltTx) PutRollSession(roll *model.RollSession) error {
+	if err := b.put(RollSessionBucket, []byte(roll.RollID), roll); err != nil {
+		return err
+	}
+	return indexRollSession(b.tx, roll)
+}
+
+func (b *boltTx) AddJournalEntry(entry *model.JournalEntry) error {
+	if !entry.Balanced() {
+		return ErrUnbalanced
+	}
+	if err := b.put(JournalBucket, []byte(entry.ID), entry); err != nil {
+		return err
+	}
+	for _, posting := range entry.Postings {
+		balance, err := b.GetAccountBalance(posting.Account)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		account := model.AccountBalance{Account: posting.Account, Balance: balance + posting.Amount}
+		if err := b.put(AccountBalanceBucket, []byte(posting.Account), account); err != nil {
+			return err
+		}
+		index, err := b.tx.Bucket([]byte(AccountJournalIndexBucket)).CreateBucketIfNotExists([]byte(posting.Account))
+		if err != nil {
+			return err
+		}
+		if err := index.Put([]byte(entry.ID), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *boltTx) ListJournalEntries(account string) ([]model.JournalEntry, error) {
+	entries := make([]model.JournalEntry, 0)
+	index := b.tx.Bucket([]byte(AccountJournalIndexBucket)).Bucket([]byte(account))
+	if index == nil {
+		return entries, nil
+	}
+	c := index.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		var entry model.JournalEntry
+		if err := b.get(JournalBucket, k, &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (b *boltTx) GetAccountBalance(account string) (int, error) {
+	var balance model.AccountBalance
+	if err := b.get(AccountBalanceBucket, []byte(account), &balance); err != nil {
+		return 0, err
+	}
+	return balance.Balance, nil
+}
+
+func (b *boltTx) ListAccountBalances() ([]model.AccountBalance, error) {
+	balances := make([]model.AccountBalance, 0)
+	err := b.tx.Bucket([]byte(AccountBalanceBucket)).ForEach(func(k, v []byte) error {
+		var balance model.AccountBalance
+		if err := util.DecodeStruct(v, &balance); err != nil {
+			return err
+		}
+		balances = append(balances, balance)
+		return nil
+	})
+	return balances, err
+}
+
+func (b *boltTx) AddAuditEntry(entry *model.AuditEntry) error {
+	return b.put(AuditBucket, []byte(entry.ID), entry)
+}
+
+func (b *boltTx) ListAuditEntries(userID string) ([]model.AuditEntry, error) {
+	entries := make([]model.AuditEntry, 0)
+	err := b.tx.Bucket([]byte(AuditBucket)).ForEach(func(k, v []byte) error {
+		var entry model.AuditEntry
+		if err := util.DecodeStruct(v, &entry); err != nil {
+			log.Printf("error decoding audit entry %s - %s", k, err)
+			return nil
+		}
+		if userID == "" || entry.UserID == userID {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func (b *boltTx) GetIdempotencyRecord(key string) (*model.IdempotencyRecord, error) {
+	var record model.IdempotencyRecord
+	if err := b.get(IdempotencyBucket, []byte(key), &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (b *boltTx) PutIdempotencyRecord(record *model.IdempotencyRecord) error {
+	return b.put(IdempotencyBucket, []byte(record.Key), record)
+}
+
+func (b *boltTx) DeleteIdempotencyRecord(key string) error {
+	return b.tx.Bucket([]byte(IdempotencyBucket)).Delete([]byte(key))
+}
+
+func (b *boltTx) DeleteIdempotencyRecords(createdBefore int64) (int, error) {
+	bucket := b.tx.Bucket([]byte(IdempotencyBucket))
+	var stale [][]byte
+	err := bucket.ForEach(func(k, v []byte) error {
+		var record model.IdempotencyRecord
+		if err := util.DecodeStruct(v, &record); err != nil || record.CreatedAt < createdBefore {
+			stale = append(stale, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, k := range stale {
+		if err := bucket.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return len(stale), nil
+}
+
+func (b *boltTx) GetMarker(name string) (int64, error) {
+	value := b.tx.Bucket([]byte(MarkerBucket)).Get([]byte(name))
+	if value == nil {
+		return 0, ErrNotFound
+	}
+	return int64(util.Btoi(value)), nil
+}
+
+func (b *boltTx) PutMarker(name string, doneAt int64) error {
+	return b.tx.Bucket([]byte(MarkerBucket)).Put([]byte(name), util.Itob(int(doneAt)))
+}
+
+// Get and decode the value stored under key, returns ErrNotFound if there is none
+func (b *boltTx) get(bucket string, key []byte, destination any) error {
+	value := b.tx.Bucket([]byte(bucket)).Get(key)
+	if value == nil {
+		return ErrNotFound
+	}
+	if err := util.DecodeStruct(value, destination); err != nil {
+		log.Printf("error parsing struct - %s", err)
+		return err
+	}
+	return nil
+}
+
+// Encode and store data under key
+func (b *boltTx) put(bucket string, key []byte, data any) error {
+	value := util.EncodeStruct(data)
+	if value == nil {
+		return ErrUnableToEncode
+	}
+	return b.tx.Bucket([]byte(bucket)).Put(key, value)
+}
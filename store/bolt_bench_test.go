@@ -0,0 +1,164 @@
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/util"
+)
+
+// Players seeded for the benchmarks, each with finished games, rolls and transactions and one running game
+const benchUsers = 3000
+
+// Open a bolt file in the temp dir of b holding benchUsers players, returns the store and the player looked up
+func seedBolt(b *testing.B) (*BoltStore, string) {
+	b.Helper()
+	s, err := OpenBolt(filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { s.Close() })
+
+	err = s.Update(func(tx Tx) error {
+		for u := 0; u < benchUsers; u++ {
+			userID := fmt.Sprintf("user-%05d", u)
+			if err := tx.PutUser(&model.User{UserID: userID, Asset: "sat"}); err != nil {
+				return err
+			}
+			for g := 0; g < 3; g++ {
+				status := model.COMPLETED
+				if g == 2 {
+					status = model.INPROGRESS
+				}
+				sessionID := fmt.Sprintf("%s-game-%d", userID, g)
+				if err := tx.PutGameSession(&model.GameSession{SessionID: sessionID, UserId: userID, GameStatus: status}); err != nil {
+					return err
+				}
+				for r := 0; r < 2; r++ {
+					roll := &model.RollSession{RollID: fmt.Sprintf("%s-roll-%d", sessionID, r), GameSessionID: sessionID, UserID: userID, RowStatus: model.COMPLETED}
+					if g == 2 && r == 1 {
+						roll.RowStatus = model.INPROGRESS
+					}
+					if err := tx.PutRollSession(roll); err != nil {
+						return err
+					}
+				}
+				transaction := &model.Transaction{UserID: userID, Type: model.DEBIT, Description: "Rolled dice", Amount: 5}
+				if err := tx.AddTransaction(transaction); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return s, fmt.Sprintf("user-%05d", benchUsers/2)
+}
+
+// The indexed lookups against a walk over every record, which is how they were answered before the index buckets
+func BenchmarkBoltGetActiveGame(b *testing.B) {
+	s, userID := seedBolt(b)
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			err := s.View(func(tx Tx) error {
+				_, err := tx.GetActiveGame(userID)
+				return err
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			found := scanBucket(b, s, GameSessionBucket, func(v []byte) bool {
+				var session model.GameSession
+				_ = util.DecodeStruct(v, &session)
+				return session.UserId == userID && session.GameStatus == model.INPROGRESS
+			})
+			if found != 1 {
+				b.Fatalf("found %d active games", found)
+			}
+		}
+	})
+}
+
+func BenchmarkBoltGetActiveRoll(b *testing.B) {
+	s, userID := seedBolt(b)
+	sessionID := userID + "-game-2"
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			err := s.View(func(tx Tx) error {
+				_, err := tx.GetActiveRoll(sessionID)
+				return err
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			found := scanBucket(b, s, RollSessionBucket, func(v []byte) bool {
+				var roll model.RollSession
+				_ = util.DecodeStruct(v, &roll)
+				return roll.GameSessionID == sessionID && roll.RowStatus == model.INPROGRESS
+			})
+			if found != 1 {
+				b.Fatalf("found %d active rolls", found)
+			}
+		}
+	})
+}
+
+func BenchmarkBoltListTransactions(b *testing.B) {
+	s, userID := seedBolt(b)
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			err := s.View(func(tx Tx) error {
+				transactions, err := tx.ListTransactions(userID)
+				if err == nil && len(transactions) != 3 {
+					b.Fatalf("listed %d transactions", len(transactions))
+				}
+				return err
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			found := scanBucket(b, s, TransactionBucket, func(v []byte) bool {
+				var transaction model.Transaction
+				_ = util.DecodeStruct(v, &transaction)
+				return transaction.UserID == userID
+			})
+			if found != 3 {
+				b.Fatalf("found %d transactions", found)
+			}
+		}
+	})
+}
+
+// Decode every record of bucket and count the ones match accepts
+func scanBucket(b *testing.B, s *BoltStore, bucket string, match func(v []byte) bool) int {
+	found := 0
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).ForEach(func(k, v []byte) error {
+			if match(v) {
+				found++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return found
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"bytes"
+	"log"
+
+	"github.com/boltdb/bolt"
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/util"
+)
+
+// Record transaction sequence under the user's nested index bucket
+func indexTransaction(tx *bolt.Tx, userID string, key []byte) error {
+	index, err := tx.Bucket([]byte(UserTransactionIndexBucket)).CreateBucketIfNotExists([]byte(userID))
+	if err != nil {
+		return err
+	}
+	return index.Put(key, []byte{})
+}
+
+// Record session under its user and point the active game index at it while it is in progress
+func indexGameSession(tx *bolt.Tx, session *model.GameSession) error {
+	index, err := tx.Bucket([]byte(UserGameIndexBucket)).CreateBucketIfNotExists([]byte(session.UserId))
+	if err != nil {
+		return err
+	}
+	if err := index.Put([]byte(session.SessionID), []byte{}); err != nil {
+		return err
+	}
+	return setActive(tx.Bucket([]byte(ActiveGameIndexBucket)), []byte(session.UserId), []byte(session.SessionID), session.GameStatus == model.INPROGRESS)
+}
+
+// Record roll under its game session and point the active roll index at it while it is in progress
+func indexRollSession(tx *bolt.Tx, roll *model.RollSession) error {
+	index, err := tx.Bucket([]byte(GameRollIndexBucket)).CreateBucketIfNotExists([]byte(roll.GameSessionID))
+	if err != nil {
+		return err
+	}
+	if err := index.Put([]byte(roll.RollID), []byte{}); err != nil {
+		return err
+	}
+	return setActive(tx.Bucket([]byte(ActiveRollIndexBucket)), []byte(roll.GameSessionID), []byte(roll.RollID), roll.RowStatus == model.INPROGRESS)
+}
+
+// Point owner at id when active, otherwise clear the entry if it still points at id
+func setActive(bucket *bolt.Bucket, owner, id []byte, active bool) error {
+	if active {
+		return bucket.Put(owner, id)
+	}
+	if bytes.Equal(bucket.Get(owner), id) {
+		return bucket.Delete(owner)
+	}
+	return nil
+}
+
+// Build every index from the record buckets, used once for files written before indexes existed
+func rebuildIndexes(tx *bolt.Tx) error {
+	log.Println("building bolt indexes")
+	err := tx.Bucket([]byte(TransactionBucket)).ForEach(func(k, v []byte) error {
+		var transaction model.Transaction
+		if err := util.DecodeStruct(v, &transaction); err != nil {
+			log.Printf("error decoding transaction %x - %s", k, err)
+			return nil
+		}
+		return indexTransaction(tx, transaction.UserID, k)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tx.Bucket([]byte(GameSessionBucket)).ForEach(func(k, v []byte) error {
+		var session model.GameSession
+		if err := util.DecodeStruct(v, &session); err != nil || session.SessionID == "" {
+			log.Printf("skipping game session record %s", k)
+			return nil
+		}
+		return indexGameSession(tx, &session)
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket([]byte(RollSessionBucket)).ForEach(func(k, v []byte) error {
+		var roll model.RollSession
+		if err := util.DecodeStruct(v, &roll); err != nil {
+			log.Printf("error decoding roll session %s - %s", k, err)
+			return nil
+		}
+		return indexRollSession(tx, &roll)
+	})
+}
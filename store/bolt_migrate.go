@@ -0,0 +1,221 @@
+package store
+
+import (
+	"log"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/util"
+)
+
+// IDMigrationStats counts the records rewritten by MigrateLegacyIDs
+type IDMigrationStats struct {
+	GameSessions int `json:"gameSessions"`
+	RollSessions int `json:"rollSessions"`
+	MovedRolls   int `json:"movedRolls"`
+	// Games whose record was overwritten by a misplaced roll carrying the same ID
+	RestoredGames int `json:"restoredGames"`
+}
+
+// MigrateLegacyIDs gives game and roll sessions created with the old random integer IDs a new ULID built from the time
+// the session started, so they keep their place among newer sessions, and moves roll sessions that older builds of EndGame wrote into the game session bucket back where they belong.
+// When such a roll had overwritten its own game (the old IDs collided within the same second) the game is restored as completed.
+// User IDs are left untouched since players already hold them. Everything happens in one transaction
+// and the index buckets are rebuilt afterwards, so running it twice is harmless.
+func (s *BoltStore) MigrateLegacyIDs() (*IDMigrationStats, error) {
+	stats := &IDMigrationStats{}
+	now := time.Now()
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		gameBucket := tx.Bucket([]byte(GameSessionBucket))
+		rollBucket := tx.Bucket([]byte(RollSessionBucket))
+		seeded, err := legacyIDTimes(tx)
+		if err != nil {
+			return err
+		}
+
+		var (
+			sessions   []model.GameSession
+			movedRolls []model.RollSession
+			staleKeys  [][]byte
+		)
+		err = gameBucket.ForEach(func(k, v []byte) error {
+			var record struct {
+				model.GameSession
+				RollID string `json:"rollID"`
+			}
+			if err := util.DecodeStruct(v, &record); err != nil {
+				log.Printf("skipping game session record %s - %s", k, err)
+				return nil
+			}
+			if record.RollID != "" {
+				var roll model.RollSession
+				if err := util.DecodeStruct(v, &roll); err != nil {
+					return err
+				}
+				movedRolls = append(movedRolls, roll)
+				staleKeys = append(staleKeys, append([]byte(nil), k...))
+				return nil
+			}
+			if !util.IsGeneratedId(record.SessionID) {
+				sessions = append(sessions, record.GameSession)
+				staleKeys = append(staleKeys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range staleKeys {
+			if err := gameBucket.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		// Misplaced rolls were the completed copy, they replace the roll still marked in progress
+		for _, roll := range movedRolls {
+			if gameBucket.Get([]byte(roll.GameSessionID)) == nil && !hasSession(sessions, roll.GameSessionID) {
+				sessions = append(sessions, model.GameSession{
+					SessionID:  roll.GameSessionID,
+					UserId:     roll.UserID,
+					GameStatus: model.COMPLETED,
+				})
+				stats.RestoredGames++
+			}
+			value := util.EncodeStruct(roll)
+			if value == nil {
+				return ErrUnableToEncode
+			}
+			if err := rollBucket.Put([]byte(roll.RollID), value); err != nil {
+				return err
+			}
+			stats.MovedRolls++
+		}
+
+		sessionIDs := map[string]string{}
+		startedAt := map[string]time.Time{}
+		for _, session := range sessions {
+			started := sessionStart(seeded, session.SessionID, session.StartedAt, now)
+			newID := util.GenerateIdAt(started)
+			sessionIDs[session.SessionID] = newID
+			startedAt[newID] = started
+			session.SessionID = newID
+			value := util.EncodeStruct(session)
+			if value == nil {
+				return ErrUnableToEncode
+			}
+			if err := gameBucket.Put([]byte(newID), value); err != nil {
+				return err
+			}
+			stats.GameSessions++
+		}
+
+		var (
+			rolls    []model.RollSession
+			rollKeys [][]byte
+		)
+		err = rollBucket.ForEach(func(k, v []byte) error {
+			var roll model.RollSession
+			if err := util.DecodeStruct(v, &roll); err != nil {
+				log.Printf("skipping roll session record %s - %s", k, err)
+				return nil
+			}
+			_, movedGame := sessionIDs[roll.GameSessionID]
+			if !util.IsGeneratedId(roll.RollID) || movedGame {
+				rolls = append(rolls, roll)
+				rollKeys = append(rollKeys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i, roll := range rolls {
+			if err := rollBucket.Delete(rollKeys[i]); err != nil {
+				return err
+			}
+			if newID, ok := sessionIDs[roll.GameSessionID]; ok {
+				roll.GameSessionID = newID
+			}
+			if !util.IsGeneratedId(roll.RollID) {
+				//Rolls nothing else dates are put at the start of their game
+				fallback, ok := startedAt[roll.GameSessionID]
+				if !ok {
+					fallback = now
+				}
+				roll.RollID = util.GenerateIdAt(sessionStart(seeded, roll.RollID, roll.StartedAt, fallback))
+			}
+			value := util.EncodeStruct(roll)
+			if value == nil {
+				return ErrUnableToEncode
+			}
+			if err := rollBucket.Put([]byte(roll.RollID), value); err != nil {
+				return err
+			}
+			stats.RollSessions++
+		}
+
+		for _, name := range indexBuckets {
+			if err := tx.DeleteBucket([]byte(name)); err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+			if _, err := tx.CreateBucket([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return rebuildIndexes(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func hasSession(sessions []model.GameSession, sessionID string) bool {
+	for _, session := range sessions {
+		if session.SessionID == sessionID {
+			return true
+		}
+	}
+	return false
+}
+
+// Old builds made every ID from the first rand.Int after seeding math/rand with the current unix second, and wrote a transaction
+// in the same second as each game and roll. Seeding with the seconds of the transactions, and the second before in case the clock
+// ticked in between, gives the IDs that could have been made then and the second each one was made in
+func legacyIDTimes(tx *bolt.Tx) (map[string]int64, error) {
+	seconds := make(map[int64]bool)
+	err := tx.Bucket([]byte(TransactionBucket)).ForEach(func(k, v []byte) error {
+		var transaction model.Transaction
+		if err := util.DecodeStruct(v, &transaction); err != nil {
+			log.Printf("skipping transaction record %x - %s", k, err)
+			return nil
+		}
+		if transaction.Time > 0 {
+			seconds[transaction.Time] = true
+			seconds[transaction.Time-1] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	seeded := make(map[string]int64, len(seconds))
+	for second := range seconds {
+		seeded[strconv.Itoa(rand.New(rand.NewSource(second)).Int())] = second
+	}
+	return seeded, nil
+}
+
+// When a session with a legacy ID started, from its recorded start, else from the second its ID was made in, else fallback
+func sessionStart(seeded map[string]int64, legacyID string, startedAt int64, fallback time.Time) time.Time {
+	if startedAt != 0 {
+		return time.Unix(startedAt, 0)
+	}
+	if second, ok := seeded[legacyID]; ok {
+		return time.Unix(second, 0)
+	}
+	return fallback
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"math/rand"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/promisefemi/apexnetwork-take-home/model"
+)
+
+// ID an old build made in second
+func legacyID(second int64) string {
+	return strconv.Itoa(rand.New(rand.NewSource(second)).Int())
+}
+
+// New IDs carry the time the session started, from its start time, from the second its legacy ID was made in,
+// or for rolls from their game
+func TestMigrateLegacyIDsKeepsStartTimes(t *testing.T) {
+	s, err := OpenBolt(filepath.Join(t.TempDir(), "legacy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	const (
+		gameSecond int64 = 1600000000
+		rollSecond int64 = 1600000030
+		oldStart   int64 = 1500000000
+	)
+	seededGame, seededRoll := legacyID(gameSecond), legacyID(rollSecond)
+	err = s.Update(func(tx Tx) error {
+		for _, session := range []model.GameSession{
+			{SessionID: seededGame, UserId: "a", GameStatus: model.COMPLETED},
+			{SessionID: "12345", UserId: "a", GameStatus: model.COMPLETED, StartedAt: oldStart},
+		} {
+			session := session
+			if err := tx.PutGameSession(&session); err != nil {
+				return err
+			}
+		}
+		for _, roll := range []model.RollSession{
+			{RollID: seededRoll, GameSessionID: seededGame, UserID: "a", RowStatus: model.COMPLETED},
+			{RollID: "678", GameSessionID: "12345", UserID: "a", RowStatus: model.COMPLETED},
+		} {
+			roll := roll
+			if err := tx.PutRollSession(&roll); err != nil {
+				return err
+			}
+		}
+		//The roll transaction was written a second after its ID was made
+		for _, transaction := range []model.Transaction{
+			{UserID: "a", Type: model.DEBIT, Description: "Started new Game", Time: gameSecond, Amount: 20},
+			{UserID: "a", Type: model.DEBIT, Description: "Rolled dice", Time: rollSecond + 1, Amount: 5},
+		} {
+			transaction := transaction
+			if err := tx.AddTransaction(&transaction); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := s.MigrateLegacyIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.GameSessions != 2 || stats.RollSessions != 2 {
+		t.Errorf("stats %+v, want 2 games and 2 rolls", *stats)
+	}
+
+	_ = s.View(func(tx Tx) error {
+		games, err := tx.ListGameSessions("a")
+		if err != nil || len(games) != 2 {
+			t.Fatalf("listed %d games - %v", len(games), err)
+		}
+		//Oldest first, the game with a start time sorts before the one dated by its ID
+		want := []struct {
+			started int64
+			rolled  int64
+		}{{oldStart, oldStart}, {gameSecond, rollSecond}}
+		for i, game := range games {
+			if started := idSecond(t, game.SessionID); started != want[i].started {
+				t.Errorf("game %d got an ID from second %d, want %d", i, started, want[i].started)
+			}
+			rolls, err := tx.ListRollSessions(game.SessionID)
+			if err != nil || len(rolls) != 1 {
+				t.Fatalf("game %d has %d rolls - %v", i, len(rolls), err)
+			}
+			if rolled := idSecond(t, rolls[0].RollID); rolled != want[i].rolled {
+				t.Errorf("roll of game %d got an ID from second %d, want %d", i, rolled, want[i].rolled)
+			}
+		}
+		return nil
+	})
+}
+
+// Unix second in the timestamp of a ULID
+func idSecond(t *testing.T, id string) int64 {
+	t.Helper()
+	parsed, err := ulid.ParseStrict(id)
+	if err != nil {
+		t.Fatalf("%s is not a ULID - %s", id, err)
+	}
+	return int64(parsed.Time() / 1000)
+}
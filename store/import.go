@@ -0,0 +1,180 @@
+package store
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/boltdb/bolt"
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/util"
+)
+
+// ImportStats counts the records copied by ImportBolt
+type ImportStats struct {
+	Users        int `json:"users"`
+	ApiKeys      int `json:"apiKeys"`
+	Credentials  int `json:"credentials"`
+	AuthSessions int `json:"authSessions"`
+	AuditEntries int `json:"auditEntries"`
+	// Account balances are rebuilt from the journal entries as they are added
+	JournalEntries int `json:"journalEntries"`
+	Transactions   int `json:"transactions"`
+	GameSessions   int `json:"gameSessions"`
+	RollSessions   int `json:"rollSessions"`
+	Markers        int `json:"markers"`
+}
+
+// ImportBolt copies every record of the boltDB file at path into dst in a single transaction.
+// It is meant to be run once against an empty destination, transactions are appended in their original order.
+func ImportBolt(path string, dst Store) (*ImportStats, error) {
+	src, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	stats := &ImportStats{}
+	err = src.View(func(btx *bolt.Tx) error {
+		return dst.Update(func(tx Tx) error {
+			err := forEach(btx, UserBucket, func(k, v []byte) error {
+				var user model.User
+				if err := util.DecodeStruct(v, &user); err != nil {
+					return fmt.Errorf("user %s - %w", k, err)
+				}
+				stats.Users++
+				return tx.PutUser(&user)
+			})
+			if err != nil {
+				return err
+			}
+
+			err = forEach(btx, ApiKeyBucket, func(k, v []byte) error {
+				var key model.ApiKey
+				if err := util.DecodeStruct(v, &key); err != nil {
+					return fmt.Errorf("api key %x - %w", k, err)
+				}
+				stats.ApiKeys++
+				return tx.PutApiKey(&key)
+			})
+			if err != nil {
+				return err
+			}
+
+			err = forEach(btx, CredentialBucket, func(k, v []byte) error {
+				var credential model.Credential
+				if err := util.DecodeStruct(v, &credential); err != nil {
+					return fmt.Errorf("credential %s - %w", k, err)
+				}
+				stats.Credentials++
+				return tx.PutCredential(&credential)
+			})
+			if err != nil {
+				return err
+			}
+
+			err = forEach(btx, AuthSessionBucket, func(k, v []byte) error {
+				var session model.AuthSession
+				if err := util.DecodeStruct(v, &session); err != nil {
+					return fmt.Errorf("login session %x - %w", k, err)
+				}
+				stats.AuthSessions++
+				return tx.PutAuthSession(&session)
+			})
+			if err != nil {
+				return err
+			}
+
+			err = forEach(btx, AuditBucket, func(k, v []byte) error {
+				var entry model.AuditEntry
+				if err := util.DecodeStruct(v, &entry); err != nil {
+					return fmt.Errorf("audit entry %s - %w", k, err)
+				}
+				stats.AuditEntries++
+				return tx.AddAuditEntry(&entry)
+			})
+			if err != nil {
+				return err
+			}
+
+			err = forEach(btx, JournalBucket, func(k, v []byte) error {
+				var entry model.JournalEntry
+				if err := util.DecodeStruct(v, &entry); err != nil {
+					return fmt.Errorf("journal entry %s - %w", k, err)
+				}
+				stats.JournalEntries++
+				return tx.AddJournalEntry(&entry)
+			})
+			if err != nil {
+				return err
+			}
+
+			err = forEach(btx, TransactionBucket, func(k, v []byte) error {
+				var transaction model.Transaction
+				if err := util.DecodeStruct(v, &transaction); err != nil {
+					return fmt.Errorf("transaction %x - %w", k, err)
+				}
+				upgradeTransaction(&transaction)
+				stats.Transactions++
+				return tx.AddTransaction(&transaction)
+			})
+			if err != nil {
+				return err
+			}
+
+			err = forEach(btx, MarkerBucket, func(k, v []byte) error {
+				stats.Markers++
+				return tx.PutMarker(string(k), int64(util.Btoi(v)))
+			})
+			if err != nil {
+				return err
+			}
+
+			err = forEach(btx, RollSessionBucket, func(k, v []byte) error {
+				var roll model.RollSession
+				if err := util.DecodeStruct(v, &roll); err != nil {
+					return fmt.Errorf("roll session %s - %w", k, err)
+				}
+				stats.RollSessions++
+				return tx.PutRollSession(&roll)
+			})
+			if err != nil {
+				return err
+			}
+
+			// Older builds of EndGame wrote completed roll sessions into the game session bucket,
+			// those records carry a rollID and are applied on top of the roll they were meant to complete
+			return forEach(btx, GameSessionBucket, func(k, v []byte) error {
+				var record struct {
+					model.GameSession
+					RollID string `json:"rollID"`
+				}
+				if err := util.DecodeStruct(v, &record); err != nil {
+					return fmt.Errorf("game session %s - %w", k, err)
+				}
+				if record.RollID != "" {
+					var roll model.RollSession
+					if err := util.DecodeStruct(v, &roll); err != nil {
+						return fmt.Errorf("roll session %s - %w", k, err)
+					}
+					log.Printf("import: roll session %s found in %s bucket", roll.RollID, GameSessionBucket)
+					return tx.PutRollSession(&roll)
+				}
+				stats.GameSessions++
+				return tx.PutGameSession(&record.GameSession)
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Walk every key of bucket, missing buckets are treated as empty
+func forEach(tx *bolt.Tx, bucket string, fn func(k, v []byte) error) error {
+	b := tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+	return b.ForEach(fn)
+}
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/util"
+)
+
+// Records of the bolt file copied by the import test
+var (
+	importUsers = []model.User{
+		{UserID: "a", FirstName: "Ada", Asset: "sat", Wallet: 95, Username: "ada", Role: model.PLAYER},
+		{UserID: "b", FirstName: "Bea", Asset: "sat", Wallet: 40, Role: model.PLAYER, Frozen: true},
+	}
+	importTransactions = []model.Transaction{
+		{UserID: "a", Type: model.CREDIT, Reason: model.FUNDING, Asset: model.SAT, Description: "Wallet Funding", Time: 1, TimeMs: 1000, Amount: 100, EntryID: "e1"},
+		//Written before transactions carried a reason, asset or milliseconds
+		{UserID: "a", Type: model.DEBIT, Description: "Rolled dice", Time: 2, Amount: 5},
+		{UserID: "b", Type: model.CREDIT, Reason: model.FUNDING, Asset: model.SAT, Description: "Wallet Funding", Time: 3, TimeMs: 3000, Amount: 40, EntryID: "e3"},
+	}
+	importGames = []model.GameSession{
+		{SessionID: "g1", UserId: "a", GameStatus: model.COMPLETED, Rules: "target", StartedAt: 1, EndedAt: 2, RollCount: 1, Staked: 5, Totalled: true},
+		{SessionID: "g2", UserId: "b", GameStatus: model.INPROGRESS, Rules: "target", StartedAt: 3},
+	}
+	importRolls = []model.RollSession{
+		{RollID: "r1", GameSessionID: "g1", UserID: "a", WinningGame: 8, FirstRoll: 2, SecondRoll: 3, RowStatus: model.INPROGRESS, Stake: 5, Throws: []int{2, 3}},
+		{RollID: "r2", GameSessionID: "g2", UserID: "b", WinningGame: 7, FirstRoll: 1, RowStatus: model.INPROGRESS, Throws: []int{1}, StakeDue: 4},
+	}
+	importEntries = []model.JournalEntry{
+		{ID: "e1", Time: 1, Description: "Wallet Funding", Postings: []model.Posting{{Account: "user:a", Amount: 100}, {Account: "house", Amount: -100}}},
+		{ID: "e2", Time: 2, Description: "Rolled dice", Postings: []model.Posting{{Account: "user:a", Amount: -5}, {Account: "house", Amount: 5}}},
+		{ID: "e3", Time: 3, Description: "Wallet Funding", Postings: []model.Posting{{Account: "user:b", Amount: 40}, {Account: "house", Amount: -40}}},
+	}
+)
+
+// Write the import records to a new bolt file and return its path. Roll r1 is completed by a record in the game session bucket,
+// the way older builds of EndGame wrote it
+func seedImport(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "import.db")
+	s, err := OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	err = s.Update(func(tx Tx) error {
+		for i := range importUsers {
+			user := importUsers[i]
+			if err := tx.PutUser(&user); err != nil {
+				return err
+			}
+		}
+		for i := range importEntries {
+			entry := importEntries[i]
+			if err := tx.AddJournalEntry(&entry); err != nil {
+				return err
+			}
+		}
+		for i := range importTransactions {
+			transaction := importTransactions[i]
+			if err := tx.AddTransaction(&transaction); err != nil {
+				return err
+			}
+		}
+		for i := range importGames {
+			session := importGames[i]
+			if err := tx.PutGameSession(&session); err != nil {
+				return err
+			}
+		}
+		for i := range importRolls {
+			roll := importRolls[i]
+			if err := tx.PutRollSession(&roll); err != nil {
+				return err
+			}
+		}
+		return tx.PutMarker("job", 7)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	completed := importRolls[0]
+	completed.RowStatus = model.COMPLETED
+	completed.EndedAt = 2
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(GameSessionBucket)).Put([]byte("stray"), util.EncodeStruct(completed))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Users, transactions, sessions, balances and markers read back from every destination the way they were written to bolt
+func TestImportBolt(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			path := seedImport(t)
+			dst := backend.open(t)
+			defer dst.Close()
+
+			stats, err := ImportBolt(path, dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := ImportStats{Users: 2, JournalEntries: 3, Transactions: 3, GameSessions: 2, RollSessions: 2, Markers: 1}
+			if *stats != want {
+				t.Errorf("stats %+v, want %+v", *stats, want)
+			}
+
+			_ = dst.View(func(tx Tx) error {
+				users, err := tx.ListUsers()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(users, importUsers) {
+					t.Errorf("users %+v, want %+v", users, importUsers)
+				}
+
+				var transactions []model.Transaction
+				err = tx.EachTransaction("", func(transaction *model.Transaction) error {
+					transactions = append(transactions, *transaction)
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(transactions) != len(importTransactions) {
+					t.Fatalf("imported %d transactions, want %d", len(transactions), len(importTransactions))
+				}
+				for i, transaction := range transactions {
+					expected := importTransactions[i]
+					upgradeTransaction(&expected)
+					expected.ID = transaction.ID
+					if !reflect.DeepEqual(transaction, expected) {
+						t.Errorf("transaction %d imported as %+v, want %+v", i, transaction, expected)
+					}
+				}
+
+				for _, expected := range importGames {
+					session, err := tx.GetGameSession(expected.SessionID)
+					if err != nil || !reflect.DeepEqual(*session, expected) {
+						t.Errorf("game %s imported as %+v, want %+v - %v", expected.SessionID, session, expected, err)
+					}
+				}
+				if session, err := tx.GetActiveGame("b"); err != nil || session.SessionID != "g2" {
+					t.Errorf("active game of b %+v, want g2 - %v", session, err)
+				}
+
+				completed := importRolls[0]
+				completed.RowStatus = model.COMPLETED
+				completed.EndedAt = 2
+				for _, expected := range []model.RollSession{completed, importRolls[1]} {
+					roll, err := tx.GetRollSession(expected.RollID)
+					if err != nil || !reflect.DeepEqual(*roll, expected) {
+						t.Errorf("roll %s imported as %+v, want %+v - %v", expected.RollID, roll, expected, err)
+					}
+				}
+				if _, err := tx.GetActiveRoll("g1"); err == nil {
+					t.Errorf("roll completed in the game session bucket is still active")
+				}
+
+				if doneAt, err := tx.GetMarker("job"); err != nil || doneAt != 7 {
+					t.Errorf("marker imported as done at %d, want 7 - %v", doneAt, err)
+				}
+
+				balances, err := tx.ListAccountBalances()
+				if err != nil {
+					t.Fatal(err)
+				}
+				wantBalances := []model.AccountBalance{{Account: "house", Balance: -135}, {Account: "user:a", Balance: 95}, {Account: "user:b", Balance: 40}}
+				if !reflect.DeepEqual(balances, wantBalances) {
+					t.Errorf("balances %+v, want %+v", balances, wantBalances)
+				}
+				return nil
+			})
+		})
+	}
+}
@@ -0,0 +1,445 @@
+package store
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/promisefemi/apexnetwork-take-home/model"
+)
+
+// MemoryStore keeps all records in process memory, it is meant for tests and local runs
+type MemoryStore struct {
+	mu    sync.RWMutex
+	state *memoryState
+}
+
+type memoryState struct {
+	users        map[string]model.User
+	apiKeys      map[string]model.ApiKey
+	credentials  map[string]model.Credential
+	authSessions map[string]model.AuthSession
+	transactions []model.Transaction
+	gameSessions map[string]model.GameSession
+	rollSessions map[string]model.RollSession
+	idempotency  map[string]model.IdempotencyRecord
+	auditLog     []model.AuditEntry
+	journal      []model.JournalEntry
+	balances     map[string]int
+	markers      map[string]int64
+	// session and roll keys in byte order, so listings match the bolt cursor
+	gameOrder []string
+	rollOrder []string
+}
+
+// Create and returns new empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{state: &memoryState{
+		users:        map[string]model.User{},
+		apiKeys:      map[string]model.ApiKey{},
+		credentials:  map[string]model.Credential{},
+		authSessions: map[string]model.AuthSession{},
+		gameSessions: map[string]model.GameSession{},
+		rollSessions: map[string]model.RollSession{},
+		idempotency:  map[string]model.IdempotencyRecord{},
+		balances:     map[string]int{},
+		markers:      map[string]int64{},
+	}}
+}
+
+func (s *MemoryStore) View(fn func(tx Tx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return fn(&memoryTx{s.state})
+}
+
+// Update runs fn against a copy of the current state, the copy replaces the state only if fn succeeds
+func (s *MemoryStore) Update(fn func(tx Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := s.state.clone()
+	if err := fn(&memoryTx{next}); err != nil {
+		return err
+	}
+	s.state = next
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (m *memoryState) clone() *memoryState {
+	next := &memoryState{
+		users:        make(map[string]model.User, len(m.users)),
+		apiKeys:      make(map[string]model.ApiKey, len(m.apiKeys)),
+		credentials:  make(map[string]model.Credential, len(m.credentials)),
+		authSessions: make(map[string]model.AuthSession, len(m.authSessions)),
+		transactions: append([]model.Transaction(nil), m.transactions...),
+		gameSessions: make(map[string]model.GameSession, len(m.gameSessions)),
+		rollSessions: make(map[string]model.RollSession, len(m.rollSessions)),
+		idempotency:  make(map[string]model.IdempotencyRecord, len(m.idempotency)),
+		auditLog:     append([]model.AuditEntry(nil), m.auditLog...),
+		journal:      append([]model.JournalEntry(nil), m.journal...),
+		balances:     make(map[string]int, len(m.balances)),
+		markers:      make(map[string]int64, len(m.markers)),
+		gameOrder:    append([]string(nil), m.gameOrder...),
+		rollOrder:    append([]string(nil), m.rollOrder...),
+	}
+	for k, v := range m.users {
+		next.users[k] = v
+	}
+	for k, v := range m.apiKeys {
+		next.apiKeys[k] = v
+	}
+	for k, v := range m.credentials {
+		next.credentials[k] = v
+	}
+	for k, v := range m.authSessions {
+		next.authSessions[k] = v
+	}
+	for k, v := range m.gameSessions {
+		next.gameSessions[k] = v
+	}
+	for k, v := range m.rollSessions {
+		next.rollSessions[k] = v
+	}
+	for k, v := range m.idempotency {
+		next.idempotency[k] = v
+	}
+	for k, v := range m.balances {
+		next.balances[k] = v
+	}
+	for k, v := range m.markers {
+		next.markers[k] = v
+	}
+	return next
+}
+
+type memoryTx struct {
+	state *memoryState
+}
+
+func (m *memoryTx) GetUser(userID string) (*model.User, error) {
+	user, ok := m.state.users[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (m *memoryTx) ListUsers() ([]model.User, error) {
+	users := make([]model.User, 0, len(m.state.users))
+	for _, user := range m.state.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+	return users, nil
+}
+
+func (m *memoryTx) PutUser(user *model.User) error {
+	m.state.users[user.UserID] = *user
+	return nil
+}
+
+func (m *memoryTx) GetApiKey(keyHash string) (*model.ApiKey, error) {
+	key, ok := m.state.apiKeys[keyHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &key, nil
+}
+
+func (m *memoryTx) PutApiKey(key *model.ApiKey) error {
+	m.state.apiKeys[key.KeyHash] = *key
+	return nil
+}
+
+func (m *memoryTx) GetCredential(username string) (*model.Credential, error) {
+	credential, ok := m.state.credentials[username]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &credential, nil
+}
+
+func (m *memoryTx) PutCredential(credential *model.Credential) error {
+	m.state.credentials[credential.Username] = *credential
+	return nil
+}
+
+func (m *memoryTx) GetAuthSession(tokenHash string) (*model.AuthSession, error) {
+	session, ok := m.state.authSessions[tokenHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &session, nil
+}
+
+func (m *memoryTx) PutAuthSession(session *model.AuthSession) error {
+	m.state.authSessions[session.TokenHash] = *session
+	return nil
+}
+
+func (m *memoryTx) DeleteAuthSessions(expiredBefore int64) (int, error) {
+	removed := 0
+	for k, session := range m.state.authSessions {
+		if session.ExpiresAt < expiredBefore {
+			delete(m.state.authSessions, k)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (m *memoryTx) AddTransaction(transaction *model.Transaction) error {
+	transaction.ID = int64(len(m.state.transactions) + 1)
+	m.state.transactions = append(m.state.transactions, *transaction)
+	return nil
+}
+
+func (m *memoryTx) ListTransactions(userID string) ([]model.Transaction, error) {
+	transactions := make([]model.Transaction, 0)
+	for _, transaction := range m.state.transactions {
+		if transaction.UserID == userID {
+			transactions = append(transactions, transaction)
+		}
+	}
+	return transactions, nil
+}
+
+func (m *memoryTx) EachTransaction(userID string, fn func(transaction *model.Transaction) error) error {
+	for i := range m.state.transactions {
+		transaction := m.state.transactions[i]
+		if userID != "" && transaction.UserID != userID {
+			continue
+		}
+		if err := fn(&transaction); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryTx) QueryTransactions(query TransactionQuery) ([]model.Transaction, error) {
+	transactions := make([]model.Transaction, 0)
+	//Transaction IDs are their position in the slice plus one
+	all := m.state.transactions
+	for i := range all {
+		index := len(all) - 1 - i
+		if query.Ascending {
+			index = i
+		}
+		transaction := all[index]
+		if query.AfterID != 0 && ((query.Ascending && transaction.ID <= query.AfterID) || (!query.Ascending && transaction.ID >= query.AfterID)) {
+			continue
+		}
+		if transaction.UserID != query.UserID || !query.matches(&transaction) {
+			continue
+		}
+		transactions = append(transactions, transaction)
+		if len(transactions) == query.Limit {
+			break
+		}
+	}
+	return transactions, nil
+}
+
+func (m *memoryTx) GetGameSession(sessionID string) (*model.GameSession, error) {
+	session, ok := m.state.gameSessions[sessionID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &session, nil
+}
+
+func (m *memoryTx) GetActiveGame(userID string) (*model.GameSession, error) {
+	for _, id := range m.state.gameOrder {
+		session := m.state.gameSessions[id]
+		if session.UserId == userID && session.GameStatus == model.INPROGRESS {
+			return &session, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *memoryTx) ListGameSessions(userID string) ([]model.GameSession, error) {
+	sessions := make([]model.GameSession, 0)
+	for _, id := range m.state.gameOrder {
+		if session := m.state.gameSessions[id]; session.UserId == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *memoryTx) QueryGameSessions(query GameQuery) ([]model.GameSession, error) {
+	sessions := make([]model.GameSession, 0)
+	for i := len(m.state.gameOrder) - 1; i >= 0; i-- {
+		id := m.state.gameOrder[i]
+		if query.BeforeID != "" && id >= query.BeforeID {
+			continue
+		}
+		session := m.state.gameSessions[id]
+		if session.UserId != query.UserID {
+			continue
+		}
+		sessions = append(sessions, session)
+		if len(sessions) == query.Limit {
+			break
+		}
+	}
+	return sessions, nil
+}
+
+func (m *memoryTx) PutGameSession(session *model.GameSession) error {
+	if _, ok := m.state.gameSessions[session.SessionID]; !ok {
+		m.state.gameOrder = insertSorted(m.state.gameOrder, session.SessionID)
+	}
+	m.state.gameSessions[session.SessionID] = *session
+	return nil
+}
+
+func (m *memoryTx) GetRollSession(rollID string) (*model.RollSession, error) {
+	roll, ok := m.state.rollSessions[rollID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &roll, nil
+}
+
+func (m *memoryTx) GetActiveRoll(gameSessionID string) (*model.RollSession, error) {
+	for _, id := range m.state.rollOrder {
+		roll := m.state.rollSessions[id]
+		if roll.GameSessionID == gameSessionID && roll.RowStatus == model.INPROGRESS {
+			return &roll, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *memoryTx) ListRollSessions(gameSessionID string) ([]model.RollSession, error) {
+	rolls := make([]model.RollSession, 0)
+	for _, id := range m.state.rollOrder {
+		if roll := m.state.rollSessions[id]; roll.GameSessionID == gameSessionID {
+			rolls = append(rolls, roll)
+		}
+	}
+	return rolls, nil
+}
+
+func (m *memoryTx) PutRollSession(roll *model.RollSession) error {
+	if _, ok := m.state.rollSessions[roll.RollID]; !ok {
+		m.state.rollOrder = insertSorted(m.state.rollOrder, roll.RollID)
+	}
+	m.state.rollSessions[roll.RollID] = *roll
+	return nil
+}
+
+func (m *memoryTx) AddJournalEntry(entry *model.JournalEntry) error {
+	if !entry.Balanced() {
+		return ErrUnbalanced
+	}
+	stored := *entry
+	stored.Postings = append([]model.Posting(nil), entry.Postings...)
+	m.state.journal = append(m.state.journal, stored)
+	for _, posting := range entry.Postings {
+		m.state.balances[posting.Account] += posting.Amount
+	}
+	return nil
+}
+
+func (m *memoryTx) ListJournalEntries(account string) ([]model.JournalEntry, error) {
+	entries := make([]model.JournalEntry, 0)
+	for _, entry := range m.state.journal {
+		for _, posting := range entry.Postings {
+			if posting.Account == account {
+				entries = append(entries, entry)
+				break
+			}
+		}
+	}
+	return entries, nil
+}
+
+func (m *memoryTx) GetAccountBalance(account string) (int, error) {
+	balance, ok := m.state.balances[account]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return balance, nil
+}
+
+func (m *memoryTx) ListAccountBalances() ([]model.AccountBalance, error) {
+	balances := make([]model.AccountBalance, 0, len(m.state.balances))
+	for account, balance := range m.state.balances {
+		balances = append(balances, model.AccountBalance{Account: account, Balance: balance})
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].Account < balances[j].Account })
+	return balances, nil
+}
+
+func (m *memoryTx) AddAuditEntry(entry *model.AuditEntry) error {
+	m.state.auditLog = append(m.state.auditLog, *entry)
+	return nil
+}
+
+func (m *memoryTx) ListAuditEntries(userID string) ([]model.AuditEntry, error) {
+	entries := make([]model.AuditEntry, 0)
+	for _, entry := range m.state.auditLog {
+		if userID == "" || entry.UserID == userID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (m *memoryTx) GetIdempotencyRecord(key string) (*model.IdempotencyRecord, error) {
+	record, ok := m.state.idempotency[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &record, nil
+}
+
+func (m *memoryTx) PutIdempotencyRecord(record *model.IdempotencyRecord) error {
+	m.state.idempotency[record.Key] = *record
+	return nil
+}
+
+func (m *memoryTx) DeleteIdempotencyRecord(key string) error {
+	delete(m.state.idempotency, key)
+	return nil
+}
+
+func (m *memoryTx) DeleteIdempotencyRecords(createdBefore int64) (int, error) {
+	removed := 0
+	for k, record := range m.state.idempotency {
+		if record.CreatedAt < createdBefore {
+			delete(m.state.idempotency, k)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (m *memoryTx) GetMarker(name string) (int64, error) {
+	doneAt, ok := m.state.markers[name]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return doneAt, nil
+}
+
+func (m *memoryTx) PutMarker(name string, doneAt int64) error {
+	m.state.markers[name] = doneAt
+	return nil
+}
+
+// Keep keys in byte order, the same order a bolt cursor walks them in
+func insertSorted(keys []string, key string) []string {
+	i := sort.SearchStrings(keys, key)
+	keys = append(keys, "")
+	copy(keys[i+1:], keys[i:])
+	keys[i] = key
+	return keys
+}
@@ -0,0 +1,290 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// migration is one versioned step of the sqlite schema, versions must only ever be appended
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create users, transactions, game and roll sessions",
+		sql: `
+CREATE TABLE users (
+	user_id    TEXT PRIMARY KEY,
+	first_name TEXT NOT NULL,
+	last_name  TEXT NOT NULL,
+	wallet     INTEGER NOT NULL DEFAULT 0,
+	asset      TEXT NOT NULL
+);
+
+CREATE TABLE transactions (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id     TEXT NOT NULL,
+	type        TEXT NOT NULL,
+	description TEXT NOT NULL,
+	time        INTEGER NOT NULL,
+	amount      INTEGER NOT NULL
+);
+CREATE INDEX transactions_user_id ON transactions (user_id, id);
+
+CREATE TABLE game_sessions (
+	session_id TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL,
+	status     TEXT NOT NULL
+);
+CREATE INDEX game_sessions_user_status ON game_sessions (user_id, status);
+
+CREATE TABLE roll_sessions (
+	roll_id         TEXT PRIMARY KEY,
+	game_session_id TEXT NOT NULL,
+	user_id         TEXT NOT NULL,
+	winning_game    INTEGER NOT NULL,
+	first_roll      INTEGER NOT NULL,
+	second_roll     INTEGER NOT NULL,
+	status          TEXT NOT NULL
+);
+CREATE INDEX roll_sessions_game_status ON roll_sessions (game_session_id, status);
+`,
+	},
+	{
+		version: 2,
+		name:    "add provably fair seeds and nonces",
+		sql: `
+ALTER TABLE game_sessions ADD COLUMN server_seed_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE game_sessions ADD COLUMN server_seed TEXT NOT NULL DEFAULT '';
+ALTER TABLE game_sessions ADD COLUMN client_seed TEXT NOT NULL DEFAULT '';
+ALTER TABLE game_sessions ADD COLUMN nonce INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE roll_sessions ADD COLUMN nonce INTEGER NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		version: 3,
+		name:    "create idempotency keys",
+		sql: `
+CREATE TABLE idempotency_keys (
+	key          TEXT PRIMARY KEY,
+	request_hash TEXT NOT NULL,
+	status_code  INTEGER NOT NULL,
+	body         BLOB,
+	created_at   INTEGER NOT NULL
+);
+CREATE INDEX idempotency_keys_created_at ON idempotency_keys (created_at);
+`,
+	},
+	{
+		version: 4,
+		name:    "create api keys",
+		sql: `
+CREATE TABLE api_keys (
+	key_hash   TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL REFERENCES users (user_id),
+	created_at INTEGER NOT NULL
+);
+CREATE INDEX api_keys_user_id ON api_keys (user_id);
+`,
+	},
+	{
+		version: 5,
+		name:    "create credentials and login sessions",
+		sql: `
+CREATE TABLE credentials (
+	username      TEXT PRIMARY KEY,
+	user_id       TEXT NOT NULL UNIQUE REFERENCES users (user_id),
+	password_hash TEXT NOT NULL,
+	created_at    INTEGER NOT NULL
+);
+
+CREATE TABLE auth_sessions (
+	token_hash TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL REFERENCES users (user_id),
+	created_at INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL,
+	revoked_at INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX auth_sessions_expires_at ON auth_sessions (expires_at);
+`,
+	},
+	{
+		version: 6,
+		name:    "add user roles, frozen accounts and the audit log",
+		sql: `
+ALTER TABLE users ADD COLUMN username TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN frozen INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE audit_log (
+	id       TEXT PRIMARY KEY,
+	action   TEXT NOT NULL,
+	actor_id TEXT NOT NULL,
+	user_id  TEXT NOT NULL,
+	reason   TEXT NOT NULL,
+	detail   TEXT NOT NULL DEFAULT '',
+	time     INTEGER NOT NULL
+);
+CREATE INDEX audit_log_user_id ON audit_log (user_id, id);
+`,
+	},
+	{
+		version: 7,
+		name:    "create double entry ledger",
+		sql: `
+CREATE TABLE journal_entries (
+	id          TEXT PRIMARY KEY,
+	time        INTEGER NOT NULL,
+	description TEXT NOT NULL
+);
+
+CREATE TABLE journal_postings (
+	entry_id TEXT NOT NULL REFERENCES journal_entries (id),
+	position INTEGER NOT NULL,
+	account  TEXT NOT NULL,
+	amount   INTEGER NOT NULL,
+	PRIMARY KEY (entry_id, position)
+);
+CREATE INDEX journal_postings_account ON journal_postings (account, entry_id);
+
+CREATE TABLE account_balances (
+	account TEXT PRIMARY KEY,
+	balance INTEGER NOT NULL
+);
+`,
+	},
+	{
+		version: 8,
+		name:    "add reason, references, balance after and milliseconds to transactions",
+		sql: `
+ALTER TABLE transactions ADD COLUMN reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE transactions ADD COLUMN time_ms INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE transactions ADD COLUMN entry_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE transactions ADD COLUMN session_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE transactions ADD COLUMN roll_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE transactions ADD COLUMN balance_after INTEGER;
+
+UPDATE transactions SET time_ms = time * 1000;
+UPDATE transactions SET reason = CASE description
+	WHEN 'Started new Game' THEN 'game_start'
+	WHEN 'Rolled dice' THEN 'roll_stake'
+	WHEN 'Winnings' THEN 'win_payout'
+	WHEN 'Wallet Funding' THEN 'funding'
+	WHEN 'Reconciliation adjustment' THEN 'adjustment'
+	ELSE '' END;
+`,
+	},
+	{
+		version: 9,
+		name:    "add asset to transactions",
+		sql: `
+ALTER TABLE transactions ADD COLUMN asset TEXT NOT NULL DEFAULT 'sat';
+`,
+	},
+	{
+		version: 10,
+		name:    "add rules to game sessions",
+		sql: `
+ALTER TABLE game_sessions ADD COLUMN rules TEXT NOT NULL DEFAULT 'target';
+`,
+	},
+	{
+		version: 11,
+		name:    "add stake and payout to roll sessions",
+		sql: `
+ALTER TABLE roll_sessions ADD COLUMN stake INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE roll_sessions ADD COLUMN payout INTEGER NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		version: 12,
+		name:    "add start and end times to game and roll sessions",
+		sql: `
+ALTER TABLE game_sessions ADD COLUMN started_at INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE game_sessions ADD COLUMN ended_at INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE roll_sessions ADD COLUMN started_at INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE roll_sessions ADD COLUMN ended_at INTEGER NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		version: 13,
+		name:    "add throws to roll sessions",
+		sql: `
+ALTER TABLE roll_sessions ADD COLUMN throws TEXT NOT NULL DEFAULT '';
+`,
+	},
+	{
+		version: 14,
+		name:    "add totals to game sessions",
+		sql: `
+ALTER TABLE game_sessions ADD COLUMN roll_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE game_sessions ADD COLUMN wins INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE game_sessions ADD COLUMN staked INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE game_sessions ADD COLUMN won INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE game_sessions ADD COLUMN totalled INTEGER NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		version: 15,
+		name:    "add stake due to roll sessions",
+		sql: `
+ALTER TABLE roll_sessions ADD COLUMN stake_due INTEGER NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		version: 16,
+		name:    "create markers of one-off jobs",
+		sql: `
+CREATE TABLE markers (
+	name    TEXT PRIMARY KEY,
+	done_at INTEGER NOT NULL
+);
+`,
+	},
+}
+
+// Apply every migration newer than the recorded schema version, each one in its own transaction
+func migrate(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	applied_at INTEGER NOT NULL
+)`)
+	if err != nil {
+		return fmt.Errorf("unable to create schema_migrations table - %w", err)
+	}
+
+	var current int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("unable to read schema version - %w", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(m.sql); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d (%s) failed - %w", m.version, m.name, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`, m.version, m.name, time.Now().Unix()); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("unable to record migration %d - %w", m.version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		log.Printf("applied migration %d - %s", m.version, m.name)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/promisefemi/apexnetwork-take-home/model"
+)
+
+// Versions recorded in the schema_migrations table of the sqlite file at path
+func appliedVersions(t *testing.T, path string) []int {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT version FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	versions := make([]int, 0)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+// Every migration is applied once in order to a new database, opening it again applies none
+func TestMigrateEmptyDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.sqlite")
+	for open := 0; open < 2; open++ {
+		s, err := OpenSQLite(path)
+		if err != nil {
+			t.Fatalf("open %d - %s", open, err)
+		}
+		s.Close()
+
+		versions := appliedVersions(t, path)
+		if len(versions) != len(migrations) {
+			t.Fatalf("open %d recorded %d migrations, want %d", open, len(versions), len(migrations))
+		}
+		for i, m := range migrations {
+			if versions[i] != m.version {
+				t.Errorf("open %d recorded version %d at %d, want %d", open, versions[i], i, m.version)
+			}
+		}
+	}
+}
+
+// A database left at the first schema is brought up to date and its records read back with the defaults of the newer columns
+func TestMigrateFromVersionOne(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "v1.sqlite")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, statement := range []string{
+		`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at INTEGER NOT NULL)`,
+		migrations[0].sql,
+		`INSERT INTO schema_migrations (version, name, applied_at) VALUES (1, 'create users, transactions, game and roll sessions', 0)`,
+		`INSERT INTO users (user_id, first_name, last_name, wallet, asset) VALUES ('player', 'Ada', 'Lovelace', 95, 'sat')`,
+		`INSERT INTO transactions (user_id, type, description, time, amount) VALUES ('player', 'CREDIT', 'Wallet Funding', 100, 100)`,
+		`INSERT INTO transactions (user_id, type, description, time, amount) VALUES ('player', 'DEBIT', 'Rolled dice', 200, 5)`,
+		`INSERT INTO game_sessions (session_id, user_id, status) VALUES ('game', 'player', 'IN_PROGRESS')`,
+		`INSERT INTO roll_sessions (roll_id, game_session_id, user_id, winning_game, first_roll, second_roll, status) VALUES ('roll', 'game', 'player', 8, 2, 0, 'IN_PROGRESS')`,
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	s, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if versions := appliedVersions(t, path); versions[len(versions)-1] != migrations[len(migrations)-1].version {
+		t.Errorf("schema at version %d, want %d", versions[len(versions)-1], migrations[len(migrations)-1].version)
+	}
+
+	_ = s.View(func(tx Tx) error {
+		user, err := tx.GetUser("player")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Wallet != 95 || user.Role != "" || user.Frozen {
+			t.Errorf("user %+v, want wallet 95 without role or freeze", *user)
+		}
+
+		transactions, err := tx.ListTransactions("player")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []model.Transaction{
+			{Type: model.CREDIT, Reason: model.FUNDING, Asset: model.SAT, TimeMs: 100000, Amount: 100},
+			{Type: model.DEBIT, Reason: model.ROLL_STAKE, Asset: model.SAT, TimeMs: 200000, Amount: 5},
+		}
+		if len(transactions) != len(want) {
+			t.Fatalf("listed %d transactions, want %d", len(transactions), len(want))
+		}
+		for i, transaction := range transactions {
+			if transaction.Type != want[i].Type || transaction.Reason != want[i].Reason || transaction.Asset != want[i].Asset ||
+				transaction.TimeMs != want[i].TimeMs || transaction.Amount != want[i].Amount {
+				t.Errorf("transaction %d read back as %+v, want %+v", i, transaction, want[i])
+			}
+		}
+
+		session, err := tx.GetActiveGame("player")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.SessionID != "game" || session.Rules != "target" || session.Totalled {
+			t.Errorf("game %+v, want the target rules and not totalled", *session)
+		}
+		roll, err := tx.GetActiveRoll("game")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if roll.RollID != "roll" || roll.FirstRoll != 2 || roll.Stake != 0 || roll.StakeDue != 0 || roll.Throws != nil {
+			t.Errorf("roll %+v, want roll without stake or throws", *roll)
+		}
+		return nil
+	})
+
+	//Records written after the migration use every column
+	err = s.Update(func(tx Tx) error {
+		return tx.PutUser(&model.User{UserID: "admin", Asset: "sat", Username: "admin", Role: model.ADMIN})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,608 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/promisefemi/apexnetwork-take-home/model"
+	"github.com/promisefemi/apexnetwork-take-home/util"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLiteStore keeps all records in a sqlite database file
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// Opens sqlite database at path, runs pending migrations and returns a store backed by it
+func OpenSQLite(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	// A single connection serialises writers, so read-check-write in Update is race safe like bolt
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db}, nil
+}
+
+func (s *SQLiteStore) View(fn func(tx Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return fn(&sqlTx{tx})
+}
+
+func (s *SQLiteStore) Update(fn func(tx Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(&sqlTx{tx}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+type sqlTx struct {
+	tx *sql.Tx
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+const (
+	userColumns        = `user_id, first_name, last_name, wallet, asset, username, role, frozen`
+	transactionColumns = `id, user_id, type, reason, asset, description, time, time_ms, amount, entry_id, session_id, roll_id, balance_after`
+	gameColumns        = `session_id, user_id, status, server_seed_hash, server_seed, client_seed, nonce, rules, started_at, ended_at, roll_count, wins, staked, won, totalled`
+	rollColumns        = `roll_id, game_session_id, user_id, winning_game, first_roll, second_roll, status, nonce, stake, payout, started_at, ended_at, throws, stake_due`
+)
+
+func scanUser(row scanner) (*model.User, error) {
+	var user model.User
+	err := row.Scan(&user.UserID, &user.FirstName, &user.LastName, &user.Wallet, &user.Asset, &user.Username, &user.Role, &user.Frozen)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func scanTransaction(row scanner) (*model.Transaction, error) {
+	var (
+		transaction  model.Transaction
+		balanceAfter sql.NullInt64
+	)
+	err := row.Scan(&transaction.ID, &transaction.UserID, &transaction.Type, &transaction.Reason, &transaction.Asset, &transaction.Description, &transaction.Time, &transaction.TimeMs,
+		&transaction.Amount, &transaction.EntryID, &transaction.SessionID, &transaction.RollID, &balanceAfter)
+	if err != nil {
+		return nil, err
+	}
+	if balanceAfter.Valid {
+		balance := int(balanceAfter.Int64)
+		transaction.BalanceAfter = &balance
+	}
+	return &transaction, nil
+}
+
+func scanGame(row scanner) (*model.GameSession, error) {
+	var session model.GameSession
+	err := row.Scan(&session.SessionID, &session.UserId, &session.GameStatus, &session.ServerSeedHash, &session.ServerSeed, &session.ClientSeed, &session.Nonce, &session.Rules, &session.StartedAt, &session.EndedAt,
+		&session.RollCount, &session.Wins, &session.Staked, &session.Won, &session.Totalled)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func scanRoll(row scanner) (*model.RollSession, error) {
+	var (
+		roll   model.RollSession
+		throws string
+	)
+	err := row.Scan(&roll.RollID, &roll.GameSessionID, &roll.UserID, &roll.WinningGame, &roll.FirstRoll, &roll.SecondRoll, &roll.RowStatus, &roll.Nonce, &roll.Stake, &roll.Payout, &roll.StartedAt, &roll.EndedAt, &throws, &roll.StakeDue)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	//Throws are kept as a JSON array, rounds from before they were recorded have none
+	if throws != "" {
+		if err := util.DecodeStruct([]byte(throws), &roll.Throws); err != nil {
+			return nil, err
+		}
+	}
+	return &roll, nil
+}
+
+func (s *sqlTx) GetUser(userID string) (*model.User, error) {
+	return scanUser(s.tx.QueryRow(`SELECT `+userColumns+` FROM users WHERE user_id = ?`, userID))
+}
+
+func (s *sqlTx) PutUser(user *model.User) error {
+	_, err := s.tx.Exec(`INSERT INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (user_id) DO UPDATE SET first_name = excluded.first_name, last_name = excluded.last_name, wallet = excluded.wallet, asset = excluded.asset,
+	username = excluded.username, role = excluded.role, frozen = excluded.frozen`,
+		user.UserID, user.FirstName, user.LastName, user.Wallet, user.Asset, user.Username, user.Role, user.Frozen)
+	return err
+}
+
+func (s *sqlTx) ListUsers() ([]model.User, error) {
+	rows, err := s.tx.Query(`SELECT ` + userColumns + ` FROM users ORDER BY user_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]model.User, 0)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+func (s *sqlTx) GetApiKey(keyHash string) (*model.ApiKey, error) {
+	var key model.ApiKey
+	err := s.tx.QueryRow(`SELECT key_hash, user_id, created_at FROM api_keys WHERE key_hash = ?`, keyHash).
+		Scan(&key.KeyHash, &key.UserID, &key.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (s *sqlTx) PutApiKey(key *model.ApiKey) error {
+	_, err := s.tx.Exec(`INSERT INTO api_keys (key_hash, user_id, created_at) VALUES (?, ?, ?)
+ON CONFLICT (key_hash) DO UPDATE SET user_id = excluded.user_id, created_at = excluded.created_at`,
+		key.KeyHash, key.UserID, key.CreatedAt)
+	return err
+}
+
+func (s *sqlTx) GetCredential(username string) (*model.Credential, error) {
+	var credential model.Credential
+	err := s.tx.QueryRow(`SELECT username, user_id, password_hash, created_at FROM credentials WHERE username = ?`, username).
+		Scan(&credential.Username, &credential.UserID, &credential.PasswordHash, &credential.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+func (s *sqlTx) PutCredential(credential *model.Credential) error {
+	_, err := s.tx.Exec(`INSERT INTO credentials (username, user_id, password_hash, created_at) VALUES (?, ?, ?, ?)
+ON CONFLICT (username) DO UPDATE SET user_id = excluded.user_id, password_hash = excluded.password_hash, created_at = excluded.created_at`,
+		credential.Username, credential.UserID, credential.PasswordHash, credential.CreatedAt)
+	return err
+}
+
+func (s *sqlTx) GetAuthSession(tokenHash string) (*model.AuthSession, error) {
+	var session model.AuthSession
+	err := s.tx.QueryRow(`SELECT token_hash, user_id, created_at, expires_at, revoked_at FROM auth_sessions WHERE token_hash = ?`, tokenHash).
+		Scan(&session.TokenHash, &session.UserID, &session.CreatedAt, &session.ExpiresAt, &session.RevokedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *sqlTx) PutAuthSession(session *model.AuthSession) error {
+	_, err := s.tx.Exec(`INSERT INTO auth_sessions (token_hash, user_id, created_at, expires_at, revoked_at) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (token_hash) DO UPDATE SET user_id = excluded.user_id, created_at = excluded.created_at, expires_at = excluded.expires_at, revoked_at = excluded.revoked_at`,
+		session.TokenHash, session.UserID, session.CreatedAt, session.ExpiresAt, session.RevokedAt)
+	return err
+}
+
+func (s *sqlTx) DeleteAuthSessions(expiredBefore int64) (int, error) {
+	result, err := s.tx.Exec(`DELETE FROM auth_sessions WHERE expires_at < ?`, expiredBefore)
+	if err != nil {
+		return 0, err
+	}
+	removed, err := result.RowsAffected()
+	return int(removed), err
+}
+
+func (s *sqlTx) AddTransaction(transaction *model.Transaction) error {
+	var balanceAfter sql.NullInt64
+	if transaction.BalanceAfter != nil {
+		balanceAfter = sql.NullInt64{Int64: int64(*transaction.BalanceAfter), Valid: true}
+	}
+	asset := transaction.Asset
+	if asset == "" {
+		asset = model.SAT
+	}
+	result, err := s.tx.Exec(`INSERT INTO transactions (user_id, type, reason, asset, description, time, time_ms, amount, entry_id, session_id, roll_id, balance_after)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		transaction.UserID, transaction.Type, transaction.Reason, asset, transaction.Description, transaction.Time, transaction.TimeMs,
+		transaction.Amount, transaction.EntryID, transaction.SessionID, transaction.RollID, balanceAfter)
+	if err != nil {
+		return err
+	}
+	transaction.ID, err = result.LastInsertId()
+	return err
+}
+
+func (s *sqlTx) ListTransactions(userID string) ([]model.Transaction, error) {
+	rows, err := s.tx.Query(`SELECT `+transactionColumns+` FROM transactions WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := make([]model.Transaction, 0)
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, *transaction)
+	}
+	return transactions, rows.Err()
+}
+
+func (s *sqlTx) EachTransaction(userID string, fn func(transaction *model.Transaction) error) error {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	if userID == "" {
+		rows, err = s.tx.Query(`SELECT ` + transactionColumns + ` FROM transactions ORDER BY id`)
+	} else {
+		rows, err = s.tx.Query(`SELECT `+transactionColumns+` FROM transactions WHERE user_id = ? ORDER BY id`, userID)
+	}
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(transaction); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqlTx) QueryTransactions(query TransactionQuery) ([]model.Transaction, error) {
+	where := []string{`user_id = ?`}
+	args := []any{query.UserID}
+	if query.Type != "" {
+		where = append(where, `type = ?`)
+		args = append(args, query.Type)
+	}
+	if query.Reason != "" {
+		where = append(where, `reason = ?`)
+		args = append(args, query.Reason)
+	}
+	if query.Asset != "" {
+		where = append(where, `asset = ?`)
+		args = append(args, query.Asset)
+	}
+	if query.From != 0 {
+		where = append(where, `time_ms >= ?`)
+		args = append(args, query.From)
+	}
+	if query.To != 0 {
+		where = append(where, `time_ms < ?`)
+		args = append(args, query.To)
+	}
+	order := `DESC`
+	if query.Ascending {
+		order = `ASC`
+		if query.AfterID != 0 {
+			where = append(where, `id > ?`)
+			args = append(args, query.AfterID)
+		}
+	} else if query.AfterID != 0 {
+		where = append(where, `id < ?`)
+		args = append(args, query.AfterID)
+	}
+	//A negative limit is no limit in sqlite
+	limit := query.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	args = append(args, limit)
+
+	rows, err := s.tx.Query(`SELECT `+transactionColumns+` FROM transactions WHERE `+strings.Join(where, ` AND `)+` ORDER BY id `+order+` LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := make([]model.Transaction, 0)
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, *transaction)
+	}
+	return transactions, rows.Err()
+}
+
+func (s *sqlTx) GetGameSession(sessionID string) (*model.GameSession, error) {
+	return scanGame(s.tx.QueryRow(`SELECT `+gameColumns+` FROM game_sessions WHERE session_id = ?`, sessionID))
+}
+
+func (s *sqlTx) GetActiveGame(userID string) (*model.GameSession, error) {
+	return scanGame(s.tx.QueryRow(`SELECT `+gameColumns+` FROM game_sessions WHERE user_id = ? AND status = ? ORDER BY session_id LIMIT 1`, userID, model.INPROGRESS))
+}
+
+func (s *sqlTx) ListGameSessions(userID string) ([]model.GameSession, error) {
+	rows, err := s.tx.Query(`SELECT `+gameColumns+` FROM game_sessions WHERE user_id = ? ORDER BY session_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]model.GameSession, 0)
+	for rows.Next() {
+		session, err := scanGame(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *sqlTx) QueryGameSessions(query GameQuery) ([]model.GameSession, error) {
+	//A negative limit is no limit in sqlite
+	limit := query.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := s.tx.Query(`SELECT `+gameColumns+` FROM game_sessions WHERE user_id = ? AND (? = '' OR session_id < ?) ORDER BY session_id DESC LIMIT ?`,
+		query.UserID, query.BeforeID, query.BeforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]model.GameSession, 0)
+	for rows.Next() {
+		session, err := scanGame(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *sqlTx) PutGameSession(session *model.GameSession) error {
+	_, err := s.tx.Exec(`INSERT INTO game_sessions (`+gameColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (session_id) DO UPDATE SET user_id = excluded.user_id, status = excluded.status,
+	server_seed_hash = excluded.server_seed_hash, server_seed = excluded.server_seed, client_seed = excluded.client_seed, nonce = excluded.nonce,
+	rules = excluded.rules, started_at = excluded.started_at, ended_at = excluded.ended_at,
+	roll_count = excluded.roll_count, wins = excluded.wins, staked = excluded.staked, won = excluded.won, totalled = excluded.totalled`,
+		session.SessionID, session.UserId, session.GameStatus, session.ServerSeedHash, session.ServerSeed, session.ClientSeed, session.Nonce, session.Rules,
+		session.StartedAt, session.EndedAt, session.RollCount, session.Wins, session.Staked, session.Won, session.Totalled)
+	return err
+}
+
+func (s *sqlTx) GetRollSession(rollID string) (*model.RollSession, error) {
+	return scanRoll(s.tx.QueryRow(`SELECT `+rollColumns+` FROM roll_sessions WHERE roll_id = ?`, rollID))
+}
+
+func (s *sqlTx) GetActiveRoll(gameSessionID string) (*model.RollSession, error) {
+	return scanRoll(s.tx.QueryRow(`SELECT `+rollColumns+` FROM roll_sessions WHERE game_session_id = ? AND status = ? ORDER BY roll_id LIMIT 1`, gameSessionID, model.INPROGRESS))
+}
+
+func (s *sqlTx) ListRollSessions(gameSessionID string) ([]model.RollSession, error) {
+	rows, err := s.tx.Query(`SELECT `+rollColumns+` FROM roll_sessions WHERE game_session_id = ? ORDER BY roll_id`, gameSessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rolls := make([]model.RollSession, 0)
+	for rows.Next() {
+		roll, err := scanRoll(rows)
+		if err != nil {
+			return nil, err
+		}
+		rolls = append(rolls, *roll)
+	}
+	return rolls, rows.Err()
+}
+
+func (s *sqlTx) PutRollSession(roll *model.RollSession) error {
+	throws := ""
+	if len(roll.Throws) > 0 {
+		throws = string(util.EncodeStruct(roll.Throws))
+	}
+	_, err := s.tx.Exec(`INSERT INTO roll_sessions (`+rollColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (roll_id) DO UPDATE SET game_session_id = excluded.game_session_id, user_id = excluded.user_id,
+	winning_game = excluded.winning_game, first_roll = excluded.first_roll, second_roll = excluded.second_roll, status = excluded.status, nonce = excluded.nonce,
+	stake = excluded.stake, payout = excluded.payout, started_at = excluded.started_at, ended_at = excluded.ended_at, throws = excluded.throws,
+	stake_due = excluded.stake_due`,
+		roll.RollID, roll.GameSessionID, roll.UserID, roll.WinningGame, roll.FirstRoll, roll.SecondRoll, roll.RowStatus, roll.Nonce, roll.Stake, roll.Payout,
+		roll.StartedAt, roll.EndedAt, throws, roll.StakeDue)
+	return err
+}
+
+func (s *sqlTx) AddJournalEntry(entry *model.JournalEntry) error {
+	if !entry.Balanced() {
+		return ErrUnbalanced
+	}
+	_, err := s.tx.Exec(`INSERT INTO journal_entries (id, time, description) VALUES (?, ?, ?)`, entry.ID, entry.Time, entry.Description)
+	if err != nil {
+		return err
+	}
+	for i, posting := range entry.Postings {
+		_, err := s.tx.Exec(`INSERT INTO journal_postings (entry_id, position, account, amount) VALUES (?, ?, ?, ?)`, entry.ID, i, posting.Account, posting.Amount)
+		if err != nil {
+			return err
+		}
+		_, err = s.tx.Exec(`INSERT INTO account_balances (account, balance) VALUES (?, ?)
+ON CONFLICT (account) DO UPDATE SET balance = balance + excluded.balance`, posting.Account, posting.Amount)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlTx) ListJournalEntries(account string) ([]model.JournalEntry, error) {
+	rows, err := s.tx.Query(`SELECT e.id, e.time, e.description, p.account, p.amount FROM journal_entries e
+JOIN journal_postings p ON p.entry_id = e.id
+WHERE e.id IN (SELECT entry_id FROM journal_postings WHERE account = ?)
+ORDER BY e.id, p.position`, account)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]model.JournalEntry, 0)
+	for rows.Next() {
+		var (
+			entry   model.JournalEntry
+			posting model.Posting
+		)
+		if err := rows.Scan(&entry.ID, &entry.Time, &entry.Description, &posting.Account, &posting.Amount); err != nil {
+			return nil, err
+		}
+		if n := len(entries); n == 0 || entries[n-1].ID != entry.ID {
+			entries = append(entries, entry)
+		}
+		last := &entries[len(entries)-1]
+		last.Postings = append(last.Postings, posting)
+	}
+	return entries, rows.Err()
+}
+
+func (s *sqlTx) GetAccountBalance(account string) (int, error) {
+	var balance int
+	err := s.tx.QueryRow(`SELECT balance FROM account_balances WHERE account = ?`, account).Scan(&balance)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return balance, err
+}
+
+func (s *sqlTx) ListAccountBalances() ([]model.AccountBalance, error) {
+	rows, err := s.tx.Query(`SELECT account, balance FROM account_balances ORDER BY account`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := make([]model.AccountBalance, 0)
+	for rows.Next() {
+		var balance model.AccountBalance
+		if err := rows.Scan(&balance.Account, &balance.Balance); err != nil {
+			return nil, err
+		}
+		balances = append(balances, balance)
+	}
+	return balances, rows.Err()
+}
+
+func (s *sqlTx) AddAuditEntry(entry *model.AuditEntry) error {
+	_, err := s.tx.Exec(`INSERT INTO audit_log (id, action, actor_id, user_id, reason, detail, time) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		entry.ID, entry.Action, entry.ActorID, entry.UserID, entry.Reason, entry.Detail, entry.Time)
+	return err
+}
+
+func (s *sqlTx) ListAuditEntries(userID string) ([]model.AuditEntry, error) {
+	rows, err := s.tx.Query(`SELECT id, action, actor_id, user_id, reason, detail, time FROM audit_log WHERE ? = '' OR user_id = ? ORDER BY id`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]model.AuditEntry, 0)
+	for rows.Next() {
+		var entry model.AuditEntry
+		if err := rows.Scan(&entry.ID, &entry.Action, &entry.ActorID, &entry.UserID, &entry.Reason, &entry.Detail, &entry.Time); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *sqlTx) GetIdempotencyRecord(key string) (*model.IdempotencyRecord, error) {
+	var record model.IdempotencyRecord
+	err := s.tx.QueryRow(`SELECT key, request_hash, status_code, body, created_at FROM idempotency_keys WHERE key = ?`, key).
+		Scan(&record.Key, &record.RequestHash, &record.StatusCode, &record.Body, &record.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (s *sqlTx) PutIdempotencyRecord(record *model.IdempotencyRecord) error {
+	_, err := s.tx.Exec(`INSERT INTO idempotency_keys (key, request_hash, status_code, body, created_at) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (key) DO UPDATE SET request_hash = excluded.request_hash, status_code = excluded.status_code, body = excluded.body, created_at = excluded.created_at`,
+		record.Key, record.RequestHash, record.StatusCode, record.Body, record.CreatedAt)
+	return err
+}
+
+func (s *sqlTx) DeleteIdempotencyRecord(key string) error {
+	_, err := s.tx.Exec(`DELETE FROM idempotency_keys WHERE key = ?`, key)
+	return err
+}
+
+func (s *sqlTx) DeleteIdempotencyRecords(createdBefore int64) (int, error) {
+	result, err := s.tx.Exec(`DELETE FROM idempotency_keys WHERE created_at < ?`, createdBefore)
+	if err != nil {
+		return 0, err
+	}
+	removed, err := result.RowsAffected()
+	return int(removed), err
+}
+
+func (s *sqlTx) GetMarker(name string) (int64, error) {
+	var doneAt int64
+	err := s.tx.QueryRow(`SELECT done_at FROM markers WHERE name = ?`, name).Scan(&doneAt)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return doneAt, err
+}
+
+func (s *sqlTx) PutMarker(name string, doneAt int64) error {
+	_, err := s.tx.Exec(`INSERT INTO markers (name, done_at) VALUES (?, ?) ON CONFLICT (name) DO UPDATE SET done_at = excluded.done_at`, name, doneAt)
+	return err
+}
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"errors"
+
+	"github.com/promisefemi/apexnetwork-take-home/model"
+)
+
+// ERRORS
+var (
+	ErrNotFound       error = errors.New("record not found")
+	ErrUnableToEncode error = errors.New("unable to encode record")
+	ErrAlreadyExists  error = errors.New("record already exists")
+	ErrUnbalanced     error = errors.New("journal entry postings do not sum to zero")
+)
+
+// Store is implemented by every storage backend, all reads and writes happen inside View or Update
+type Store interface {
+	// View runs fn inside a read-only transaction
+	View(fn func(tx Tx) error) error
+	// Update runs fn inside a read-write transaction, nothing is persisted if fn returns an error
+	Update(fn func(tx Tx) error) error
+	Close() error
+}
+
+// Tx exposes users, API keys, credentials, login sessions, transactions, the ledger, game sessions, roll sessions and the audit log within an open transaction
+type Tx interface {
+	GetUser(userID string) (*model.User, error)
+	// ListUsers returns every user ordered by user ID
+	ListUsers() ([]model.User, error)
+	PutUser(user *model.User) error
+
+	GetApiKey(keyHash string) (*model.ApiKey, error)
+	PutApiKey(key *model.ApiKey) error
+
+	GetCredential(username string) (*model.Credential, error)
+	PutCredential(credential *model.Credential) error
+
+	GetAuthSession(tokenHash string) (*model.AuthSession, error)
+	PutAuthSession(session *model.AuthSession) error
+	// DeleteAuthSessions removes sessions that expired before the given unix time and returns how many were removed
+	DeleteAuthSessions(expiredBefore int64) (int, error)
+
+	// AddTransaction stores the transaction and sets its ID to the next sequence number
+	AddTransaction(transaction *model.Transaction) error
+	// ListTransactions returns the transactions of userID oldest first
+	ListTransactions(userID string) ([]model.Transaction, error)
+	// EachTransaction calls fn with every transaction of userID, or of every user when it is empty, oldest first.
+	// Records are read one at a time inside the open transaction, nothing is collected in memory
+	EachTransaction(userID string, fn func(transaction *model.Transaction) error) error
+	// QueryTransactions returns one page of the transactions of query.UserID that match its filters
+	QueryTransactions(query TransactionQuery) ([]model.Transaction, error)
+
+	GetGameSession(sessionID string) (*model.GameSession, error)
+	GetActiveGame(userID string) (*model.GameSession, error)
+	ListGameSessions(userID string) ([]model.GameSession, error)
+	// QueryGameSessions returns one page of the games of query.UserID, newest first
+	QueryGameSessions(query GameQuery) ([]model.GameSession, error)
+	PutGameSession(session *model.GameSession) error
+
+	GetRollSession(rollID string) (*model.RollSession, error)
+	GetActiveRoll(gameSessionID string) (*model.RollSession, error)
+	ListRollSessions(gameSessionID string) ([]model.RollSession, error)
+	PutRollSession(roll *model.RollSession) error
+
+	// AddJournalEntry stores a balanced entry and applies its postings to the account balances, unbalanced entries are rejected with ErrUnbalanced
+	AddJournalEntry(entry *model.JournalEntry) error
+	// ListJournalEntries returns the entries with a posting to account, oldest first
+	ListJournalEntries(account string) ([]model.JournalEntry, error)
+	// GetAccountBalance returns ErrNotFound for accounts that were never posted to
+	GetAccountBalance(account string) (int, error)
+	// ListAccountBalances returns every account ordered by name
+	ListAccountBalances() ([]model.AccountBalance, error)
+
+	AddAuditEntry(entry *model.AuditEntry) error
+	// ListAuditEntries returns the audit log oldest first, only entries about userID unless it is empty
+	ListAuditEntries(userID string) ([]model.AuditEntry, error)
+
+	GetIdempotencyRecord(key string) (*model.IdempotencyRecord, error)
+	PutIdempotencyRecord(record *model.IdempotencyRecord) error
+	DeleteIdempotencyRecord(key string) error
+	// DeleteIdempotencyRecords removes records created before the given unix time and returns how many were removed
+	DeleteIdempotencyRecords(createdBefore int64) (int, error)
+
+	// GetMarker returns the unix time a one-off job recorded itself as done under name, ErrNotFound if it never did
+	GetMarker(name string) (int64, error)
+	PutMarker(name string, doneAt int64) error
+}
+
+// Position of a page of games
+type GameQuery struct {
+	UserID string
+	// Page continues with the games before the one with this session ID, empty starts at the newest
+	BeforeID string
+	// Most games returned, 0 returns all
+	Limit int
+}
+
+// Filters and position of a page of transactions, zero values match everything
+type TransactionQuery struct {
+	UserID string
+	Type   model.TransactionType
+	Reason model.TransactionReason
+	Asset  model.Asset
+	// TimeMs range, From inclusive and To exclusive
+	From int64
+	To   int64
+	// Page continues after the transaction with this ID in the chosen order, 0 starts at the beginning
+	AfterID int64
+	// Oldest first instead of newest first
+	Ascending bool
+	// Most transactions returned, 0 returns all
+	Limit int
+}
+
+// Reports whether transaction passes the filters of the query, the position is checked by the backends
+func (q TransactionQuery) matches(transaction *model.Transaction) bool {
+	if q.Type != "" && transaction.Type != q.Type {
+		return false
+	}
+	if q.Reason != "" && transaction.Reason != q.Reason {
+		return false
+	}
+	if q.Asset != "" && transaction.Asset != q.Asset {
+		return false
+	}
+	if q.From != 0 && transaction.TimeMs < q.From {
+		return false
+	}
+	if q.To != 0 && transaction.TimeMs >= q.To {
+		return false
+	}
+	return true
+}
+
+// Reasons of transactions written before they carried one, known by their description
+var legacyReasons = map[string]model.TransactionReason{
+	"Started new Game":          model.GAME_START,
+	"Rolled dice":               model.ROLL_STAKE,
+	"Winnings":                  model.WIN_PAYOUT,
+	"Wallet Funding":            model.FUNDING,
+	"Reconciliation adjustment": model.ADJUSTMENT,
+}
+
+// Fill in what can be recovered of the fields older transactions were written without
+func upgradeTransaction(transaction *model.Transaction) {
+	if transaction.TimeMs == 0 {
+		transaction.TimeMs = transaction.Time * 1000
+	}
+	if transaction.Reason == "" {
+		transaction.Reason = legacyReasons[transaction.Description]
+	}
+	if transaction.Asset == "" {
+		transaction.Asset = model.SAT
+	}
+}
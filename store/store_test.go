@@ -0,0 +1,475 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/promisefemi/apexnetwork-take-home/model"
+)
+
+// Every backend opened fresh for one test
+var backends = []struct {
+	name string
+	open func(t *testing.T) Store
+}{
+	{"memory", func(t *testing.T) Store { return NewMemoryStore() }},
+	{"bolt", func(t *testing.T) Store {
+		s, err := OpenBolt(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}},
+	{"sqlite", func(t *testing.T) Store {
+		s, err := OpenSQLite(filepath.Join(t.TempDir(), "test.sqlite"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}},
+}
+
+// Run fn once against every backend
+func eachBackend(t *testing.T, fn func(t *testing.T, s Store)) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			s := backend.open(t)
+			t.Cleanup(func() { s.Close() })
+			fn(t, s)
+		})
+	}
+}
+
+// Run fn inside a write transaction and fail the test on its error
+func update(t *testing.T, s Store, fn func(tx Tx) error) {
+	t.Helper()
+	if err := s.Update(fn); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreUsers(t *testing.T) {
+	eachBackend(t, func(t *testing.T, s Store) {
+		update(t, s, func(tx Tx) error {
+			for _, user := range []model.User{
+				{UserID: "b", FirstName: "Bea", Asset: "sat", Wallet: 10, Role: model.PLAYER},
+				{UserID: "a", FirstName: "Ada", Asset: "sat", Username: "ada", Role: model.ADMIN, Frozen: true},
+			} {
+				user := user
+				if err := tx.PutUser(&user); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		_ = s.View(func(tx Tx) error {
+			user, err := tx.GetUser("a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := (model.User{UserID: "a", FirstName: "Ada", Asset: "sat", Username: "ada", Role: model.ADMIN, Frozen: true}); *user != want {
+				t.Errorf("user %+v, want %+v", *user, want)
+			}
+			if _, err := tx.GetUser("missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("missing user returned %v, want %v", err, ErrNotFound)
+			}
+			users, err := tx.ListUsers()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(users) != 2 || users[0].UserID != "a" || users[1].UserID != "b" {
+				t.Errorf("listed %+v, want a then b", users)
+			}
+			return nil
+		})
+	})
+}
+
+// Nothing written in an Update that fails is kept
+func TestStoreUpdateRollsBack(t *testing.T) {
+	failed := errors.New("failed")
+	eachBackend(t, func(t *testing.T, s Store) {
+		err := s.Update(func(tx Tx) error {
+			if err := tx.PutUser(&model.User{UserID: "a", Asset: "sat"}); err != nil {
+				return err
+			}
+			if err := tx.AddTransaction(&model.Transaction{UserID: "a", Type: model.CREDIT, Amount: 5}); err != nil {
+				return err
+			}
+			return failed
+		})
+		if err != failed {
+			t.Fatalf("update returned %v, want %v", err, failed)
+		}
+		_ = s.View(func(tx Tx) error {
+			if _, err := tx.GetUser("a"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("user kept after failed update - %v", err)
+			}
+			if transactions, _ := tx.ListTransactions("a"); len(transactions) != 0 {
+				t.Errorf("transactions kept after failed update - %+v", transactions)
+			}
+			return nil
+		})
+	})
+}
+
+func TestStoreTransactions(t *testing.T) {
+	eachBackend(t, func(t *testing.T, s Store) {
+		update(t, s, func(tx Tx) error {
+			for _, transaction := range []model.Transaction{
+				{UserID: "a", Type: model.CREDIT, Reason: model.FUNDING, Asset: model.SAT, Amount: 100, TimeMs: 1000},
+				{UserID: "b", Type: model.CREDIT, Reason: model.FUNDING, Asset: model.SAT, Amount: 50, TimeMs: 1500},
+				{UserID: "a", Type: model.DEBIT, Reason: model.ROLL_STAKE, Asset: model.SAT, Amount: 5, TimeMs: 2000, SessionID: "g1", RollID: "r1"},
+				{UserID: "a", Type: model.CREDIT, Reason: model.PROMOTION, Asset: model.BONUS, Amount: 20, TimeMs: 3000},
+				{UserID: "a", Type: model.DEBIT, Reason: model.ROLL_STAKE, Asset: model.SAT, Amount: 7, TimeMs: 4000, SessionID: "g1", RollID: "r2"},
+			} {
+				transaction := transaction
+				if err := tx.AddTransaction(&transaction); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		_ = s.View(func(tx Tx) error {
+			transactions, err := tx.ListTransactions("a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if amounts := amountsOf(transactions); !reflect.DeepEqual(amounts, []int{100, 5, 20, 7}) {
+				t.Errorf("listed amounts %v, want 100, 5, 20 and 7 oldest first", amounts)
+			}
+			for i := 1; i < len(transactions); i++ {
+				if transactions[i].ID <= transactions[i-1].ID {
+					t.Errorf("transaction IDs %d then %d do not increase", transactions[i-1].ID, transactions[i].ID)
+				}
+			}
+			if stake := transactions[1]; stake.SessionID != "g1" || stake.RollID != "r1" || stake.Reason != model.ROLL_STAKE || stake.Asset != model.SAT {
+				t.Errorf("stake read back as %+v", stake)
+			}
+
+			every := 0
+			err = tx.EachTransaction("", func(transaction *model.Transaction) error {
+				every++
+				return nil
+			})
+			if err != nil || every != 5 {
+				t.Errorf("walked %d transactions of every user, want 5 - %v", every, err)
+			}
+			return nil
+		})
+
+		tests := []struct {
+			name  string
+			query TransactionQuery
+			want  []int
+		}{
+			{"newest first", TransactionQuery{UserID: "a"}, []int{7, 20, 5, 100}},
+			{"oldest first", TransactionQuery{UserID: "a", Ascending: true}, []int{100, 5, 20, 7}},
+			{"by type", TransactionQuery{UserID: "a", Type: model.DEBIT}, []int{7, 5}},
+			{"by reason", TransactionQuery{UserID: "a", Reason: model.PROMOTION}, []int{20}},
+			{"by asset", TransactionQuery{UserID: "a", Asset: model.SAT}, []int{7, 5, 100}},
+			{"by time", TransactionQuery{UserID: "a", From: 2000, To: 4000}, []int{20, 5}},
+			{"limited", TransactionQuery{UserID: "a", Limit: 2}, []int{7, 20}},
+		}
+		for _, tt := range tests {
+			_ = s.View(func(tx Tx) error {
+				transactions, err := tx.QueryTransactions(tt.query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if amounts := amountsOf(transactions); !reflect.DeepEqual(amounts, tt.want) {
+					t.Errorf("%s: amounts %v, want %v", tt.name, amounts, tt.want)
+				}
+				return nil
+			})
+		}
+
+		//Pages follow on from the ID of the last transaction of the one before
+		var pages []int
+		query := TransactionQuery{UserID: "a", Limit: 3}
+		for {
+			var page []model.Transaction
+			_ = s.View(func(tx Tx) error {
+				var err error
+				page, err = tx.QueryTransactions(query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return nil
+			})
+			if len(page) == 0 {
+				break
+			}
+			pages = append(pages, amountsOf(page)...)
+			query.AfterID = page[len(page)-1].ID
+		}
+		if !reflect.DeepEqual(pages, []int{7, 20, 5, 100}) {
+			t.Errorf("paged amounts %v, want 7, 20, 5 and 100", pages)
+		}
+	})
+}
+
+func TestStoreGamesAndRolls(t *testing.T) {
+	eachBackend(t, func(t *testing.T, s Store) {
+		update(t, s, func(tx Tx) error {
+			for _, session := range []model.GameSession{
+				{SessionID: "g1", UserId: "a", GameStatus: model.COMPLETED, StartedAt: 1, EndedAt: 2, RollCount: 2, Wins: 1, Staked: 10, Won: 57, Totalled: true},
+				{SessionID: "g2", UserId: "b", GameStatus: model.INPROGRESS},
+				{SessionID: "g3", UserId: "a", GameStatus: model.INPROGRESS, ServerSeedHash: "hash", ServerSeed: "seed", ClientSeed: "client", Nonce: 3, Rules: "target"},
+			} {
+				session := session
+				if err := tx.PutGameSession(&session); err != nil {
+					return err
+				}
+			}
+			for _, roll := range []model.RollSession{
+				{RollID: "r1", GameSessionID: "g3", UserID: "a", WinningGame: 8, FirstRoll: 2, SecondRoll: 6, RowStatus: model.COMPLETED, Nonce: 1, Stake: 10,
+					Payout: 57, StartedAt: 5, EndedAt: 6, Throws: []int{2, 6}},
+				{RollID: "r2", GameSessionID: "g3", UserID: "a", WinningGame: 7, FirstRoll: 3, RowStatus: model.INPROGRESS, Nonce: 2, Stake: 10, Payout: 57,
+					StartedAt: 7, Throws: []int{3}, StakeDue: 10},
+			} {
+				roll := roll
+				if err := tx.PutRollSession(&roll); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		_ = s.View(func(tx Tx) error {
+			active, err := tx.GetActiveGame("a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if active.SessionID != "g3" || active.ServerSeed != "seed" || active.Nonce != 3 || active.Rules != "target" {
+				t.Errorf("active game %+v, want g3", *active)
+			}
+			if session, err := tx.GetGameSession("g1"); err != nil || session.RollCount != 2 || session.Won != 57 || !session.Totalled {
+				t.Errorf("game g1 read back as %+v - %v", session, err)
+			}
+			if _, err := tx.GetGameSession("missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("missing game returned %v, want %v", err, ErrNotFound)
+			}
+
+			sessions, err := tx.ListGameSessions("a")
+			if err != nil || len(sessions) != 2 {
+				t.Errorf("listed %d games of a, want 2 - %v", len(sessions), err)
+			}
+			page, err := tx.QueryGameSessions(GameQuery{UserID: "a", Limit: 1})
+			if err != nil || len(page) != 1 || page[0].SessionID != "g3" {
+				t.Errorf("first page %+v, want g3 - %v", page, err)
+			}
+			page, err = tx.QueryGameSessions(GameQuery{UserID: "a", BeforeID: "g3"})
+			if err != nil || len(page) != 1 || page[0].SessionID != "g1" {
+				t.Errorf("page before g3 %+v, want g1 - %v", page, err)
+			}
+
+			roll, err := tx.GetActiveRoll("g3")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := (model.RollSession{RollID: "r2", GameSessionID: "g3", UserID: "a", WinningGame: 7, FirstRoll: 3, RowStatus: model.INPROGRESS, Nonce: 2,
+				Stake: 10, Payout: 57, StartedAt: 7, Throws: []int{3}, StakeDue: 10}); !reflect.DeepEqual(*roll, want) {
+				t.Errorf("active roll %+v, want %+v", *roll, want)
+			}
+			rolls, err := tx.ListRollSessions("g3")
+			if err != nil || len(rolls) != 2 || rolls[0].RollID != "r1" || !reflect.DeepEqual(rolls[0].Throws, []int{2, 6}) {
+				t.Errorf("listed rolls %+v - %v", rolls, err)
+			}
+			return nil
+		})
+
+		//Completing the round and the game leaves nothing active
+		update(t, s, func(tx Tx) error {
+			roll, err := tx.GetRollSession("r2")
+			if err != nil {
+				return err
+			}
+			roll.RowStatus = model.COMPLETED
+			if err := tx.PutRollSession(roll); err != nil {
+				return err
+			}
+			session, err := tx.GetGameSession("g3")
+			if err != nil {
+				return err
+			}
+			session.GameStatus = model.COMPLETED
+			return tx.PutGameSession(session)
+		})
+		_ = s.View(func(tx Tx) error {
+			if _, err := tx.GetActiveRoll("g3"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("completed roll still active - %v", err)
+			}
+			if _, err := tx.GetActiveGame("a"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("completed game still active - %v", err)
+			}
+			if rolls, _ := tx.ListRollSessions("g3"); len(rolls) != 2 {
+				t.Errorf("listed %d rolls after completing one, want 2", len(rolls))
+			}
+			return nil
+		})
+	})
+}
+
+func TestStoreJournal(t *testing.T) {
+	eachBackend(t, func(t *testing.T, s Store) {
+		err := s.Update(func(tx Tx) error {
+			return tx.AddJournalEntry(&model.JournalEntry{ID: "e0", Postings: []model.Posting{{Account: "user:a", Amount: 5}}})
+		})
+		if !errors.Is(err, ErrUnbalanced) {
+			t.Errorf("unbalanced entry returned %v, want %v", err, ErrUnbalanced)
+		}
+
+		update(t, s, func(tx Tx) error {
+			for _, entry := range []model.JournalEntry{
+				{ID: "e1", Time: 1, Description: "Wallet Funding", Postings: []model.Posting{{Account: "user:a", Amount: 100}, {Account: "house", Amount: -100}}},
+				{ID: "e2", Time: 2, Description: "Rolled dice", Postings: []model.Posting{{Account: "user:a", Amount: -5}, {Account: "house", Amount: 5}}},
+				{ID: "e3", Time: 3, Description: "Wallet Funding", Postings: []model.Posting{{Account: "user:b", Amount: 40}, {Account: "house", Amount: -40}}},
+			} {
+				entry := entry
+				if err := tx.AddJournalEntry(&entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		_ = s.View(func(tx Tx) error {
+			if balance, err := tx.GetAccountBalance("user:a"); err != nil || balance != 95 {
+				t.Errorf("balance of user:a %d, want 95 - %v", balance, err)
+			}
+			if _, err := tx.GetAccountBalance("user:missing"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("balance of an account never posted to returned %v, want %v", err, ErrNotFound)
+			}
+			balances, err := tx.ListAccountBalances()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []model.AccountBalance{{Account: "house", Balance: -135}, {Account: "user:a", Balance: 95}, {Account: "user:b", Balance: 40}}
+			if !reflect.DeepEqual(balances, want) {
+				t.Errorf("balances %+v, want %+v", balances, want)
+			}
+			entries, err := tx.ListJournalEntries("user:a")
+			if err != nil || len(entries) != 2 || entries[0].ID != "e1" || entries[1].ID != "e2" || len(entries[1].Postings) != 2 {
+				t.Errorf("entries of user:a %+v, want e1 then e2 - %v", entries, err)
+			}
+			return nil
+		})
+	})
+}
+
+func TestStoreExpiringRecords(t *testing.T) {
+	eachBackend(t, func(t *testing.T, s Store) {
+		update(t, s, func(tx Tx) error {
+			//Login sessions belong to a user in sqlite
+			if err := tx.PutUser(&model.User{UserID: "a", Asset: "sat"}); err != nil {
+				return err
+			}
+			for _, session := range []model.AuthSession{{TokenHash: "old", UserID: "a", ExpiresAt: 10}, {TokenHash: "new", UserID: "a", ExpiresAt: 30}} {
+				session := session
+				if err := tx.PutAuthSession(&session); err != nil {
+					return err
+				}
+			}
+			for _, record := range []model.IdempotencyRecord{
+				{Key: "old", RequestHash: "h1", StatusCode: 200, Body: []byte(`{"status":true}`), CreatedAt: 10},
+				{Key: "new", RequestHash: "h2", StatusCode: 422, Body: []byte(`{"status":false}`), CreatedAt: 30},
+				{Key: "gone", RequestHash: "h3", CreatedAt: 30},
+			} {
+				record := record
+				if err := tx.PutIdempotencyRecord(&record); err != nil {
+					return err
+				}
+			}
+			return tx.DeleteIdempotencyRecord("gone")
+		})
+
+		update(t, s, func(tx Tx) error {
+			if removed, err := tx.DeleteAuthSessions(20); err != nil || removed != 1 {
+				t.Errorf("removed %d login sessions, want 1 - %v", removed, err)
+			}
+			if removed, err := tx.DeleteIdempotencyRecords(20); err != nil || removed != 1 {
+				t.Errorf("removed %d idempotency records, want 1 - %v", removed, err)
+			}
+			return nil
+		})
+
+		_ = s.View(func(tx Tx) error {
+			if _, err := tx.GetAuthSession("old"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expired login session returned %v, want %v", err, ErrNotFound)
+			}
+			if session, err := tx.GetAuthSession("new"); err != nil || session.ExpiresAt != 30 {
+				t.Errorf("login session %+v - %v", session, err)
+			}
+			for _, key := range []string{"old", "gone"} {
+				if _, err := tx.GetIdempotencyRecord(key); !errors.Is(err, ErrNotFound) {
+					t.Errorf("idempotency record %s returned %v, want %v", key, err, ErrNotFound)
+				}
+			}
+			record, err := tx.GetIdempotencyRecord("new")
+			if err != nil || record.RequestHash != "h2" || record.StatusCode != 422 || string(record.Body) != `{"status":false}` {
+				t.Errorf("idempotency record %+v - %v", record, err)
+			}
+			return nil
+		})
+	})
+}
+
+func TestStoreAuditLog(t *testing.T) {
+	eachBackend(t, func(t *testing.T, s Store) {
+		update(t, s, func(tx Tx) error {
+			for _, entry := range []model.AuditEntry{
+				{ID: "1", Action: model.FREEZE_ACCOUNT, ActorID: "admin", UserID: "a", Reason: "fraud", Time: 1},
+				{ID: "2", Action: model.SET_ROLE, ActorID: "admin", UserID: "b", Reason: "staff", Detail: "ADMIN", Time: 2},
+				{ID: "3", Action: model.UNFREEZE_ACCOUNT, ActorID: "admin", UserID: "a", Reason: "cleared", Time: 3},
+			} {
+				entry := entry
+				if err := tx.AddAuditEntry(&entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		_ = s.View(func(tx Tx) error {
+			entries, err := tx.ListAuditEntries("a")
+			if err != nil || len(entries) != 2 || entries[0].Action != model.FREEZE_ACCOUNT || entries[1].Reason != "cleared" {
+				t.Errorf("audit entries of a %+v - %v", entries, err)
+			}
+			if entries, _ := tx.ListAuditEntries(""); len(entries) != 3 || entries[1].Detail != "ADMIN" {
+				t.Errorf("audit log %+v, want all 3 entries", entries)
+			}
+			return nil
+		})
+	})
+}
+
+func TestStoreMarkers(t *testing.T) {
+	eachBackend(t, func(t *testing.T, s Store) {
+		update(t, s, func(tx Tx) error {
+			if _, err := tx.GetMarker("job"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("marker never put returned %v, want %v", err, ErrNotFound)
+			}
+			if err := tx.PutMarker("job", 10); err != nil {
+				return err
+			}
+			return tx.PutMarker("job", 20)
+		})
+		_ = s.View(func(tx Tx) error {
+			if doneAt, err := tx.GetMarker("job"); err != nil || doneAt != 20 {
+				t.Errorf("marker done at %d, want 20 - %v", doneAt, err)
+			}
+			return nil
+		})
+	})
+}
+
+func amountsOf(transactions []model.Transaction) []int {
+	amounts := make([]int, 0, len(transactions))
+	for _, transaction := range transactions {
+		amounts = append(amounts, transaction.Amount)
+	}
+	return amounts
+}
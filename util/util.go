@@ -1,44 +1,60 @@
 package util
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
-	"fmt"
 	"log"
-	"math/rand"
-	"strings"
+	"sync"
 	"time"
+
+	"github.com/oklog/ulid/v2"
 )
 
-func GenerateUserId(firstname, lastname string) string {
-	rand.Seed(time.Now().Unix())
-	return fmt.Sprintf("%s-%s-%d", strings.ToLower(firstname), strings.ToLower(lastname), rand.Int())
-}
+var (
+	idMu      sync.Mutex
+	idEntropy = ulid.Monotonic(rand.Reader, 0)
+)
 
+// Generate a new ULID, IDs sort by creation time and are strictly increasing within the process
 func GenerateId() string {
-	rand.Seed(time.Now().Unix())
-	return fmt.Sprintf("%d", rand.Int())
+	return GenerateIdAt(time.Now())
 }
 
-func GenerateDiceRoll() int {
-	return generateDiceRoll(1, 6)
+// Generate a ULID for a record created at t, for records that get their ID after the fact
+func GenerateIdAt(t time.Time) string {
+	idMu.Lock()
+	defer idMu.Unlock()
+	return ulid.MustNew(ulid.Timestamp(t), idEntropy).String()
 }
 
-func GenerateDiceSessionRoll() int {
-	return generateDiceRoll(2, 12)
+// Reports whether id was made by GenerateId, records from older builds use random integers
+func IsGeneratedId(id string) bool {
+	_, err := ulid.ParseStrict(id)
+	return err == nil
 }
 
-func generateDiceRoll(min, max int) int {
-	rand.Seed(time.Now().Unix())
-
-	return rand.Intn(max-min) + min
+// Generate a random secret token, prefix tells what kind of token it is when one shows up in a log or a bug report
+func GenerateToken(prefix string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
 
+// Hash token for storage, only hashes of secrets are ever written to the database
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 func EncodeStruct(data any) []byte {
 	jsonByte, err := json.Marshal(data)
 	if err != nil {
-		log.Fatalf("error parsing struct - ", err)
+		log.Fatalf("error parsing struct - %s", err)
 		return nil
 	}
 	return jsonByte
@@ -56,3 +72,8 @@ func Itob(v int) []byte {
 	binary.BigEndian.PutUint64(b, uint64(v))
 	return b
 }
+
+// Btoi reverses Itob
+func Btoi(b []byte) int {
+	return int(binary.BigEndian.Uint64(b))
+}